@@ -2,6 +2,7 @@ package part1
 
 import (
 	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/tests"
@@ -81,6 +82,8 @@ func curlWithModsecurityIntervention() *workflow.Step {
 func GetWorkflow() *workflow.Workflow {
 	return &workflow.Workflow{
 		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
 			gloo.InstallGlooEnterprise(),
 			gloo.DeleteAllVirtualServices(),
 			gloo.GlooctlCheck(),
@@ -89,6 +92,9 @@ func GetWorkflow() *workflow.Workflow {
 			// Part 1: Deploy the app
 			workflow.Apply("petstore.yaml").WithId("deploy-petstore"),
 			workflow.WaitForPods("default").WithId("wait-default"),
+			gloo.WaitForDiscoveredUpstream("default", "petstore", 8080),
+			gloo.AssertDiscoveredFunctions(gloo.DiscoveredUpstreamName("default", "petstore", 8080), gloo.RestFunctions,
+				"addPet", "deletePet", "findPetById", "findPets"),
 			workflow.Apply("vs-petstore-1.yaml").WithId("deploy-vs1"),
 			basicCurl(200, `[{"id":1,"name":"Dog","status":"available"},{"id":2,"name":"Cat","status":"pending"}]`),
 
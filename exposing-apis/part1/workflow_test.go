@@ -2,19 +2,13 @@ package part1_test
 
 import (
 	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
 	"github.com/solo-io/gloo-ref-arch/exposing-apis/part1"
-	"github.com/solo-io/go-utils/testutils"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
 	"testing"
 )
 
 func TestExposingApis(t *testing.T) {
-	RegisterFailHandler(Fail)
-	testutils.RegisterPreFailHandler(
-		func() {
-			testutils.PrintTrimmedStack()
-		})
-	testutils.RegisterCommonFailHandlers()
+	diagnostics.RegisterFailHandlers(".")
 	RunSpecs(t, "Exposing Apis Suite")
 }
 
@@ -3,10 +3,20 @@ module github.com/solo-io/gloo-ref-arch
 go 1.13
 
 require (
+	github.com/envoyproxy/go-control-plane v0.9.0
+	github.com/ghodss/yaml v1.0.1-0.20190212202910-dc05a4bc0ab4
+	github.com/golang/protobuf v1.3.2
 	github.com/onsi/ginkgo v1.10.1
 	github.com/onsi/gomega v1.7.0
+	github.com/open-policy-agent/opa v0.18.0
+	github.com/rotisserie/eris v0.1.1
 	github.com/solo-io/go-utils v0.14.0
 	github.com/solo-io/valet v0.6.1-0.20200414215703-1ac7035636cc
+	github.com/xeipuuv/gojsonschema v1.1.0
+	golang.org/x/net v0.0.0-20191028085509-fe3aa8a45271
+	google.golang.org/grpc v1.24.0
+	helm.sh/helm/v3 v3.0.0
+	k8s.io/api v0.0.0-20191121015604-11707872ac1c
 )
 
 replace (
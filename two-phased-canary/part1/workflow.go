@@ -2,6 +2,7 @@ package part1
 
 import (
 	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/tests"
@@ -30,6 +31,8 @@ func curlWithHeader(responseBody, headerName, headerValue string) *workflow.Step
 func GetWorkflow() *workflow.Workflow {
 	return &workflow.Workflow{
 		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
 			gloo.InstallGlooEnterpriseWithValues("values.yaml"),
 			gloo.DeleteAllVirtualServices(),
 			gloo.GlooctlCheck(),
@@ -2,19 +2,13 @@ package part1_test
 
 import (
 	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
 	"github.com/solo-io/gloo-ref-arch/two-phased-canary/part1"
-	"github.com/solo-io/go-utils/testutils"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
 	"testing"
 )
 
 func TestTwoPhasedCanary(t *testing.T) {
-	RegisterFailHandler(Fail)
-	testutils.RegisterPreFailHandler(
-		func() {
-			testutils.PrintTrimmedStack()
-		})
-	testutils.RegisterCommonFailHandlers()
+	diagnostics.RegisterFailHandlers(".")
 	RunSpecs(t, "Two Phased Canary Test Suite")
 }
 
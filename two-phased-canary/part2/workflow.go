@@ -2,6 +2,7 @@ package part2
 
 import (
 	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/tests"
@@ -44,6 +45,8 @@ func curlWithHeader(path, responseBody, headerName, headerValue string) *workflo
 func GetWorkflow() *workflow.Workflow {
 	return &workflow.Workflow{
 		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
 			gloo.InstallGlooEnterpriseWithValues("values.yaml"),
 			gloo.DeleteAllVirtualServices(),
 			gloo.GlooctlCheck(),
@@ -0,0 +1,115 @@
+package part3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+var canaryHeaders = map[string]string{
+	"stage": "canary",
+}
+
+func curl(path, responseBody string) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:      gloo.GatewayProxy(),
+			StatusCode:   200,
+			Path:         path,
+			ResponseBody: responseBody,
+		},
+	}
+}
+
+func curlWithHeader(path, responseBody, headerName, headerValue string) *workflow.Step {
+	step := curl(path, responseBody)
+	step.Curl.Headers = map[string]string{
+		headerName: headerValue,
+	}
+	return step
+}
+
+// Installs the team's release of the chart, or upgrades it to the values for the next stage of the workflow.
+// The valet helm step leaves existing releases as-is, so this uses helm directly.
+func helmUpgrade(team, valuesFile string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("helm upgrade %s ./gloo-app --install --namespace %s --values %s --wait", team, team, valuesFile),
+		},
+	}
+}
+
+func createNamespace(namespace string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("kubectl create ns %s", namespace),
+		},
+	}
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.InstallGlooEnterpriseWithValues("../part2/values.yaml"),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.DeleteNamespaces("echo", "foxtrot"),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy the generic virtual service, and install echo and foxtrot with the chart
+			workflow.Apply("vs.yaml").WithId("deploy-vs"),
+			createNamespace("echo"),
+			helmUpgrade("echo", "values-1.yaml").WithId("install-echo"),
+			createNamespace("foxtrot"),
+			helmUpgrade("foxtrot", "values-1.yaml").WithId("install-foxtrot"),
+			gloo.GlooctlCheck(),
+			curl("/echo", "version:echo-v1"),
+			curl("/foxtrot", "version:foxtrot-v1"),
+
+			// Part 2: Deploy echo v2, without routing to it yet
+			helmUpgrade("echo", "values-2.yaml").WithId("upgrade-echo-2"),
+			curl("/echo", "version:echo-v1"),
+			curlWithHeader("/echo", "version:echo-v1", "stage", "canary"),
+			gloo.CurlResponses("/echo", nil, "version:echo-v1"),
+
+			// Part 3: Phase 1, route requests with the canary header to v2
+			helmUpgrade("echo", "values-3.yaml").WithId("upgrade-echo-3"),
+			curlWithHeader("/echo", "version:echo-v2", "stage", "canary"),
+			gloo.CurlResponses("/echo", canaryHeaders, "version:echo-v2"),
+			gloo.CurlResponses("/echo", nil, "version:echo-v1"),
+
+			// Part 4: Phase 2, shift half of the traffic to v2
+			helmUpgrade("echo", "values-4.yaml").WithId("upgrade-echo-4"),
+			gloo.CurlResponses("/echo", canaryHeaders, "version:echo-v2"),
+			gloo.CurlResponses("/echo", nil, "version:echo-v1", "version:echo-v2"),
+
+			// Part 5: Shift all of the traffic to v2
+			helmUpgrade("echo", "values-5.yaml").WithId("upgrade-echo-5"),
+			gloo.CurlResponses("/echo", canaryHeaders, "version:echo-v2"),
+			gloo.CurlResponses("/echo", nil, "version:echo-v2"),
+
+			// Part 6: Make v2 the primary version, and decommission v1
+			helmUpgrade("echo", "values-6.yaml").WithId("upgrade-echo-6"),
+			curl("/echo", "version:echo-v2"),
+			gloo.CurlResponses("/echo", canaryHeaders, "version:echo-v2"),
+			gloo.CurlResponses("/echo", nil, "version:echo-v2"),
+			curl("/foxtrot", "version:foxtrot-v1"),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package part3_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/two-phased-canary/part3"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"testing"
+)
+
+func TestTwoPhasedCanary(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Two Phased Canary Test Suite")
+}
+
+var _ = Describe("Two Phased Canary, Part 3", func() {
+	testWorkflow := part3.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
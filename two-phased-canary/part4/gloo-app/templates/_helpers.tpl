@@ -0,0 +1,57 @@
+{{/*
+The options for a route, from routing.options. Shadowing is only set on the primary route, since requests that
+match the canary route are already sent to the canary.
+Takes a dict with the options, the release namespace, whether to shadow, and the root context that header
+values are rendered with, e.g. to include the release name.
+*/}}
+{{- define "gloo-app.routeOptions" -}}
+{{- $options := .options -}}
+{{- with $options.timeout }}
+timeout: {{ . }}
+{{- end }}
+{{- with $options.retries }}
+retries:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- if or $options.requestHeaders $options.responseHeaders }}
+headerManipulation:
+  {{- with $options.requestHeaders }}
+  {{- with .add }}
+  requestHeadersToAdd:
+    {{- range $key, $value := . }}
+    - header:
+        key: {{ $key }}
+        value: {{ tpl $value $.root | quote }}
+    {{- end }}
+  {{- end }}
+  {{- with .remove }}
+  requestHeadersToRemove:
+    {{- toYaml . | nindent 4 }}
+  {{- end }}
+  {{- end }}
+  {{- with $options.responseHeaders }}
+  {{- with .add }}
+  responseHeadersToAdd:
+    {{- range $key, $value := . }}
+    - header:
+        key: {{ $key }}
+        value: {{ tpl $value $.root | quote }}
+    {{- end }}
+  {{- end }}
+  {{- with .remove }}
+  responseHeadersToRemove:
+    {{- toYaml . | nindent 4 }}
+  {{- end }}
+  {{- end }}
+{{- end }}
+{{- with $options.prefixRewrite }}
+prefixRewrite: {{ . | quote }}
+{{- end }}
+{{- if and .shadow $options.shadowing }}
+shadowing:
+  percentage: {{ if hasKey $options.shadowing "percentage" }}{{ $options.shadowing.percentage }}{{ else }}100{{ end }}
+  upstream:
+    name: shadow-{{ $options.shadowing.version }}
+    namespace: {{ .namespace }}
+{{- end }}
+{{- end -}}
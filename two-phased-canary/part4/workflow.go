@@ -0,0 +1,195 @@
+package part4
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/gloo-ref-arch/utils/recorder"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// Built from this repo, deployed by values-3.yaml and values-4.yaml.
+	requestRecorderImage = "quay.io/solo-io/request-recorder:dev"
+	// The request recorder lists the requests it got on this port, which isn't exposed through the gateway.
+	recorderAdminPort = 9090
+)
+
+func curl(path, responseBody string) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:      gloo.GatewayProxy(),
+			StatusCode:   200,
+			Path:         path,
+			ResponseBody: responseBody,
+		},
+	}
+}
+
+func curlWithHeaders(path string, headers map[string]string, statusCode int, responseBody string) *workflow.Step {
+	step := curl(path, responseBody)
+	step.Curl.Headers = headers
+	step.Curl.StatusCode = statusCode
+	return step
+}
+
+// Installs the release of the chart, or upgrades it to the values for the next stage of the workflow.
+// The valet helm step leaves existing releases as-is, so this uses helm directly.
+func helmUpgrade(release, valuesFile string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("helm upgrade %s ./gloo-app --install --namespace %s --values %s --wait", release, release, valuesFile),
+		},
+	}
+}
+
+func createNamespace(namespace string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("kubectl create ns %s", namespace),
+		},
+	}
+}
+
+// A curl to the version's request recorder, e.g. /requests?path=/echo/foo.
+func recordedRequests(deployment, path string) *check.Curl {
+	return &check.Curl{
+		Path:       path,
+		StatusCode: 200,
+		Attempts:   30,
+		PortForward: &check.PortForward{
+			Namespace:      "echo",
+			DeploymentName: deployment,
+			Port:           recorderAdminPort,
+		},
+	}
+}
+
+// Waits until the version's request recorder has seen a request to the path, either mirrored or routed to it.
+func curlRecorded(deployment, path string, shadow bool) *workflow.Step {
+	curl := recordedRequests(deployment, fmt.Sprintf("/requests?path=%s&shadow=%t", path, shadow))
+	curl.ResponseBodySubstring = fmt.Sprintf(`"path":"%s","shadow":%t`, path, shadow)
+	return &workflow.Step{Curl: curl}
+}
+
+// Waits until the version's request recorder has seen a request to the path with the header, e.g. one added by the
+// route options.
+func curlRecordedHeader(deployment, path, header, value string) *workflow.Step {
+	curl := recordedRequests(deployment, fmt.Sprintf("/requests?path=%s", path))
+	curl.ResponseBodySubstring = fmt.Sprintf(`"%s":"%s"`, header, value)
+	return &workflow.Step{Curl: curl}
+}
+
+// Waits until the version's request recorder has seen the number of requests to the path, e.g. a request and its
+// retries.
+func curlRecordedCount(deployment, path string, count int) *workflow.Step {
+	curl := recordedRequests(deployment, fmt.Sprintf("/requests/count?path=%s", path))
+	curl.ResponseBody = fmt.Sprintf("%d", count)
+	return &workflow.Step{Curl: curl}
+}
+
+// Checks that the version's request recorder hasn't seen any requests to the path with the header, e.g. one removed by
+// the route options. Use after curlRecordedCount, so that the requests are known to have arrived.
+func curlNotRecordedHeader(deployment, path, header string) *workflow.Step {
+	curl := recordedRequests(deployment, fmt.Sprintf("/requests/count?path=%s&header=%s", path, header))
+	curl.ResponseBody = "0"
+	return &workflow.Step{Curl: curl}
+}
+
+// Checks that the version's request recorder hasn't seen any requests that were mirrored, or routed to it.
+func curlNotRecorded(deployment string, shadow bool) *workflow.Step {
+	curl := recordedRequests(deployment, fmt.Sprintf("/requests?shadow=%t", shadow))
+	curl.ResponseBody = "[]"
+	return &workflow.Step{Curl: curl}
+}
+
+// The headers that route requests to the canary, along with any others.
+func canaryHeaders(headers map[string]string) map[string]string {
+	result := map[string]string{"stage": "canary"}
+	for name, value := range headers {
+		result[name] = value
+	}
+	return result
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			cluster.BuildImage(requestRecorderImage),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.InstallGlooEnterpriseWithValues("../part2/values.yaml"),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.DeleteNamespaces("echo"),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Install echo with a route for each of its prefixes
+			workflow.Apply("vs.yaml").WithId("deploy-vs"),
+			createNamespace("echo"),
+			helmUpgrade("echo", "values-1.yaml").WithId("install-echo"),
+			gloo.GlooctlCheck(),
+			curl("/echo/foo", "version:echo-v1"),
+			curl("/echo/bar", "version:echo-v1"),
+
+			// Part 2: Deploy v2, and shadow all of the traffic to it. Clients still only see v1.
+			helmUpgrade("echo", "values-2.yaml").WithId("upgrade-echo-2"),
+			workflow.WaitForPods("echo"),
+			gloo.GlooctlCheck(),
+			gloo.CurlResponses("/echo/foo", nil, "version:echo-v1"),
+			gloo.CurlResponses("/echo/bar", nil, "version:echo-v1"),
+
+			// Part 3: Shadow half of the traffic, to versions that record their requests, and check that the
+			// mirrored requests reach v2 while v1 keeps serving every client
+			helmUpgrade("echo", "values-3.yaml").WithId("upgrade-echo-3"),
+			workflow.WaitForPods("echo"),
+			gloo.CurlResponses("/echo/foo", nil, "version:echo-v1"),
+			gloo.CurlResponses("/echo/bar", nil, "version:echo-v1"),
+			curlRecorded("echo-v1", "/echo/foo", false),
+			curlRecorded("echo-v1", "/echo/bar", false),
+			curlRecorded("echo-v2", "/echo/foo", true),
+			curlRecorded("echo-v2", "/echo/bar", true),
+			curlNotRecorded("echo-v1", true),
+			curlNotRecorded("echo-v2", false),
+
+			// Part 4: Set route options on the canary and primary routes, and check them with versions that can be
+			// asked to respond slowly or fail
+			helmUpgrade("echo", "values-4.yaml").WithId("upgrade-echo-4"),
+			workflow.WaitForPods("echo"),
+			curl("/echo/foo", "version:echo-v1"),
+			curlWithHeaders("/echo/foo", canaryHeaders(nil), 200, "version:echo-v2"),
+			// The prefix is rewritten, and the request header is added, on both routes
+			curlRecordedHeader("echo-v1", "/api", "x-gloo-app", "echo"),
+			curlRecordedHeader("echo-v2", "/api", "x-gloo-app", "echo"),
+			gloo.CurlResponseHeader("/echo/foo", "x-served-by", "gloo-app"),
+			// The internal header is removed from requests on both routes
+			curlWithHeaders("/echo/foo/internal", map[string]string{"x-internal": "true"}, 200, "version:echo-v1"),
+			curlRecordedCount("echo-v1", "/api/internal", 1),
+			curlNotRecordedHeader("echo-v1", "/api/internal", "x-internal"),
+			curlWithHeaders("/echo/foo/internal", canaryHeaders(map[string]string{"x-internal": "true"}), 200, "version:echo-v2"),
+			curlRecordedCount("echo-v2", "/api/internal", 1),
+			curlNotRecordedHeader("echo-v2", "/api/internal", "x-internal"),
+			// Requests that take longer than the timeout
+			curlWithHeaders("/echo/foo", map[string]string{recorder.DelayHeader: "3s"}, 504, "upstream request timeout"),
+			curlWithHeaders("/echo/foo", canaryHeaders(map[string]string{recorder.DelayHeader: "3s"}), 504, "upstream request timeout"),
+			// Requests that always fail are tried once, then retried twice
+			curlWithHeaders("/echo/foo/retries", map[string]string{recorder.ErrorRateHeader: "100"}, 500, recorder.ServerErrorResponse),
+			curlRecordedCount("echo-v1", "/api/retries", 3),
+			curlWithHeaders("/echo/bar/retries", canaryHeaders(map[string]string{recorder.ErrorRateHeader: "100"}), 500, recorder.ServerErrorResponse),
+			curlRecordedCount("echo-v2", "/api/retries", 3),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package part4_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/two-phased-canary/part4"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"testing"
+)
+
+func TestTwoPhasedCanary(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Two Phased Canary Test Suite")
+}
+
+var _ = Describe("Two Phased Canary, Part 4", func() {
+	testWorkflow := part4.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
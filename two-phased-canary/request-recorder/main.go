@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/solo-io/gloo-ref-arch/utils/recorder"
+)
+
+// Serves fixed text on every path like hashicorp/http-echo, taking the same flags so the gloo-app chart can use
+// either image, and lists the requests it got on a separate admin port.
+func main() {
+	text := flag.String("text", "", "the text to respond with")
+	listen := flag.String("listen", ":8080", "the address to serve the text on")
+	adminListen := flag.String("admin-listen", ":9090", "the address to serve the recorded requests on")
+	flag.Parse()
+
+	rec := recorder.NewRecorder(*text)
+	go func() {
+		if err := http.ListenAndServe(*adminListen, rec.Admin()); err != nil {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+	if err := http.ListenAndServe(*listen, rec); err != nil {
+		log.Fatal("ListenAndServe: ", err)
+	}
+}
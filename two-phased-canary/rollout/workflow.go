@@ -0,0 +1,107 @@
+package rollout
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/canary"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/gloo-ref-arch/utils/recorder"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// The start of every successful spelunker response, which goes on to print the request.
+const spelunkerResponse = "This is an example http server."
+
+func curl(responseBodySubstring string) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:               gloo.GatewayProxy(),
+			StatusCode:            200,
+			Path:                  "/",
+			ResponseBodySubstring: responseBodySubstring,
+		},
+	}
+}
+
+func createCertSecret() *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: "kubectl create secret tls spelunker-certs -n echo " +
+				"--cert ../../webinars/encryption/spelunker/localhost.crt --key ../../webinars/encryption/spelunker/localhost.key",
+		},
+	}
+}
+
+// The part 1 echo app, with v2 as the canary.
+func echoRollout() canary.Rollout {
+	return canary.Rollout{
+		VirtualService: charts.ResourceRef{Name: "echo", Namespace: "gloo-system"},
+		Domains:        []string{"*"},
+		Prefix:         "/",
+		Upstream:       charts.ResourceRef{Name: "echo", Namespace: "gloo-system"},
+		SubsetKey:      canary.DefaultSubsetKey,
+		Primary:        "v1",
+		Canary:         "v2",
+		Header:         charts.HeaderMatcher{Name: "stage", Value: "canary"},
+		Weights:        []int{10, 50, 100},
+		Interval:       canary.DefaultInterval,
+		MinRequests:    canary.DefaultMinRequests,
+		ErrorBudget:    canary.DefaultErrorBudget,
+	}
+}
+
+// Traffic that makes spelunker fail a percentage of requests. The primary ignores the header.
+func trafficWithErrorRate(percent int) canary.Traffic {
+	return canary.Traffic{
+		Path:    "/",
+		Headers: map[string]string{recorder.ErrorRateHeader: fmt.Sprint(percent)},
+	}
+}
+
+func GetWorkflow() *workflow.Workflow {
+	rollout := echoRollout()
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.InstallGlooEnterpriseWithValues("../part1/values.yaml"),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.DeleteNamespaces("echo"),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy v1 of the app, with all of its traffic routed to it
+			workflow.Apply("../part1/echo.yaml").WithId("deploy-echo"),
+			workflow.WaitForPods("echo"),
+			workflow.Apply("../part1/upstream.yaml").WithId("deploy-upstream"),
+			workflow.Apply("../part1/vs-2.yaml").WithId("deploy-vs"),
+			curl("version:v1"),
+
+			// Part 2: Deploy a v2 that fails half of its requests, and check that the rollout is rolled back
+			createCertSecret(),
+			workflow.Apply("echo-v2.yaml").WithId("deploy-echo-v2"),
+			workflow.WaitForPods("echo"),
+			rollout.Step(trafficWithErrorRate(50), canary.RolledBack),
+			gloo.CurlResponses("/", nil, "version:v1"),
+
+			// Part 3: Roll out v2 again without asking it to fail. Spelunker still fails about 1% of requests, which
+			// is within the error budget.
+			rollout.Step(trafficWithErrorRate(0), canary.Promoted),
+			curl(spelunkerResponse),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package rollout_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/two-phased-canary/rollout"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"testing"
+)
+
+func TestTwoPhasedCanary(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Two Phased Canary Test Suite")
+}
+
+var _ = Describe("Two Phased Canary, Automated Rollout", func() {
+	testWorkflow := rollout.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/solo-io/gloo-ref-arch/utils/accesslog"
+	"google.golang.org/grpc"
+)
+
+// Receives Envoy access logs over gRPC (on the port Gloo's access logger normally uses), and
+// exposes them over HTTP for workflows to assert on.
+func main() {
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":8083"
+	}
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":8080"
+	}
+
+	server := accesslog.NewServer()
+	grpcServer := grpc.NewServer()
+	server.Register(grpcServer)
+
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal("Listen: ", err)
+	}
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal("Serve: ", err)
+		}
+	}()
+	if err := http.ListenAndServe(httpAddr, server); err != nil {
+		log.Fatal("ListenAndServe: ", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/solo-io/gloo-ref-arch/utils/oidc"
+)
+
+// Serves a mock OpenID Connect provider, with the clients and users from a config file, so that oauth
+// workflows can log in without a real identity provider.
+func main() {
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = "/etc/mock-oidc-provider/config.yaml"
+	}
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":8080"
+	}
+
+	config, err := oidc.LoadConfig(configFile)
+	if err != nil {
+		log.Fatal("LoadConfig: ", err)
+	}
+	provider, err := oidc.NewProvider(*config)
+	if err != nil {
+		log.Fatal("NewProvider: ", err)
+	}
+	log.Printf("Serving issuer %s on %s", config.Issuer, httpAddr)
+	if err := http.ListenAndServe(httpAddr, provider); err != nil {
+		log.Fatal("ListenAndServe: ", err)
+	}
+}
@@ -0,0 +1,116 @@
+package mockoidc
+
+import (
+	"context"
+
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+	"github.com/solo-io/valet/pkg/render"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// The client and issuer configured in mock-oidc-provider.yaml.
+const (
+	clientId     = "gloo"
+	clientSecret = "gloo-secret"
+	issuerHost   = "mock-oidc-provider.gloo-system.svc.cluster.local:8080"
+	// Built from this repo, deployed by mock-oidc-provider.yaml.
+	mockOidcProviderImage = "quay.io/solo-io/mock-oidc-provider:dev"
+	userPassword          = "password"
+)
+
+func initialCurl() *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:    gloo.GatewayProxy(),
+			Path:       "/",
+			StatusCode: 200,
+			Attempts:   30,
+		},
+	}
+}
+
+// The auth config's app URL is localhost:8080, as in part 1, so the proxy is port-forwarded there.
+func loginAs(username string, statusCode int) *workflow.Step {
+	return login.Login{
+		Url:        "http://localhost:8080/",
+		Username:   username,
+		Password:   userPassword,
+		StatusCode: statusCode,
+		// OPA runs after the oauth config, so Gloo sets the session cookie for denied users too
+		SessionCookie: login.GlooSessionCookie,
+		CallbackPath:  "/callback",
+		PortForwards: []login.PortForward{
+			{
+				Host:      "localhost:8080",
+				Namespace: "gloo-system",
+				Resource:  "deploy/gateway-proxy",
+				Port:      8080,
+				LocalPort: 8080,
+			},
+			{
+				Host:      issuerHost,
+				Namespace: "gloo-system",
+				Resource:  "svc/mock-oidc-provider",
+				Port:      8080,
+				LocalPort: 18082,
+			},
+		},
+	}.Step()
+}
+
+// GetWorkflow runs the oauth-then-opa chain from part 1 against the mock OIDC provider instead of Google, so it
+// doesn't need Google credentials, and logs in as users that OPA allows and denies.
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		Values: render.Values{
+			"ClientSecret": clientSecret,
+			"ClientId":     clientId,
+			"IssuerUrl":    "http://" + issuerHost,
+		},
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			cluster.BuildImage(mockOidcProviderImage),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.InstallGlooEnterpriseWithValues("../values.yaml"),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy the monolith
+			workflow.Apply("../petclinic.yaml").WithId("deploy-monolith"),
+			workflow.WaitForPods("default").WithId("wait-1"),
+			gloo.WaitForDiscoveredUpstream("default", "petclinic", 8080),
+			workflow.Apply("../vs-1.yaml").WithId("vs-1"),
+			initialCurl(),
+
+			// Part 2: Deploy the mock OIDC provider
+			workflow.Apply("mock-oidc-provider.yaml").WithId("deploy-mock-oidc-provider"),
+			workflow.WaitForPods("gloo-system").WithId("wait-mock-oidc-provider"),
+
+			// Part 3: Deploy auth configs
+			workflow.ApplyTemplate("../oauth-secret.tmpl"),
+			workflow.Apply("../allow-jwt.yaml"),
+			workflow.ApplyTemplate("../auth-config.tmpl"),
+			workflow.Apply("../vs-2.yaml"),
+
+			// Part 4: Log in, as a user that OPA allows, and as one that it denies
+			loginAs("allowed", 200),
+			loginAs("denied", 403),
+
+			// Make sure everything is healthy
+			gloo.GlooctlCheck(),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
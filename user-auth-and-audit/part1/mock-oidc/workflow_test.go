@@ -0,0 +1,25 @@
+package mockoidc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	mockoidc "github.com/solo-io/gloo-ref-arch/user-auth-and-audit/part1/mock-oidc"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"testing"
+)
+
+func TestMockOidc(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "User Auth and Auditing Part 1 with a Mock OIDC Provider")
+}
+
+var _ = Describe("Part 1 with a mock OIDC provider", func() {
+	testWorkflow := mockoidc.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("runs", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -2,14 +2,27 @@ package part1
 
 import (
 	"context"
+	"fmt"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"github.com/solo-io/valet/pkg/render"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/step/kubectl"
+	"github.com/solo-io/valet/pkg/step/script"
 	"github.com/solo-io/valet/pkg/tests"
 	"github.com/solo-io/valet/pkg/workflow"
 )
 
+const (
+	stringAccessLog = "/dev/access-logs.txt"
+	jsonAccessLog   = "/dev/gateway-proxy-log.json"
+
+	issuerHost = "accounts.google.com"
+
+	// Built from this repo, deployed by access-log-receiver.yaml.
+	accessLogReceiverImage = "quay.io/solo-io/access-log-receiver:dev"
+)
+
 func initialCurl() *workflow.Step {
 	return &workflow.Step{
 		Curl: &check.Curl{
@@ -33,17 +46,25 @@ func accessLoggingPatch() *workflow.Step {
 	}
 }
 
-func turnOnExtauthDebugLogging() *workflow.Step {
+func replaceAccessLogger() *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: "kubectl scale deploy -n gloo-system gateway-proxy-access-logger --replicas=0",
+		},
+	}
+}
+
+func curlAccessLogReceiver(path string, responseCode int) *workflow.Step {
 	return &workflow.Step{
 		Curl: &check.Curl{
-			Path:        "/logging",
-			StatusCode:  200,
-			Method:      "PUT",
-			RequestBody: `{ "level": "debug" }`,
+			Path:                  fmt.Sprintf("/entries?logName=example&path=%s", path),
+			StatusCode:            200,
+			ResponseBodySubstring: fmt.Sprintf(`"responseCode":%d`, responseCode),
+			Attempts:              30,
 			PortForward: &check.PortForward{
 				Namespace:      "gloo-system",
-				DeploymentName: "extauth",
-				Port:           9091,
+				DeploymentName: "access-log-receiver",
+				Port:           8080,
 			},
 		},
 	}
@@ -54,8 +75,12 @@ func GetWorkflow() *workflow.Workflow {
 		Values: render.Values{
 			"ClientSecret": "env:GOOGLE_CLIENT_SECRET",
 			"ClientId":     "env:GOOGLE_CLIENT_ID",
+			"IssuerUrl":    "https://" + issuerHost,
 		},
 		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			cluster.BuildImage(accessLogReceiverImage),
+			gloo.CheckLicense(gloo.DefaultLicense()),
 			gloo.InstallGlooEnterpriseWithValues("values.yaml"),
 			gloo.DeleteAllVirtualServices(),
 			gloo.GlooctlCheck(),
@@ -64,18 +89,34 @@ func GetWorkflow() *workflow.Workflow {
 			// Part 1: Deploy the monolith
 			workflow.Apply("petclinic.yaml").WithId("deploy-monolith"),
 			workflow.WaitForPods("default").WithId("wait-1"),
+			gloo.WaitForDiscoveredUpstream("default", "petclinic", 8080),
 			workflow.Apply("vs-1.yaml").WithId("vs-1"),
 			initialCurl(),
 
 			// Part 2: Deploy access loggers
 			accessLoggingPatch(),
+			gloo.MarkAccessLog(stringAccessLog, "access-logging"),
+			gloo.MarkAccessLog(jsonAccessLog, "access-logging"),
+			gloo.AssertAccessLogLine(stringAccessLog, "access-logging", "/", `"GET / HTTP/1.1" 200`),
+			gloo.AssertAccessLogFields(jsonAccessLog, "access-logging", "/", map[string]string{
+				"protocol":        "HTTP/1.1",
+				"upstreamCluster": "default-petclinic-8080_gloo-system",
+			}),
+			replaceAccessLogger(),
+			workflow.Apply("access-log-receiver.yaml").WithId("deploy-access-log-receiver"),
+			workflow.WaitForPods("gloo-system"),
+			initialCurl(),
+			curlAccessLogReceiver("/", 200),
 
-			// Part 3: Deploy auth configs and debug logging for extauth
+			// Part 3: Turn on debug logging for extauth, and deploy auth configs, so that requests are
+			// redirected to log in with the issuer
+			gloo.SetLogLevel(gloo.ExtauthLogging, "debug"),
 			workflow.ApplyTemplate("oauth-secret.tmpl"),
 			workflow.Apply("allow-jwt.yaml"),
 			workflow.ApplyTemplate("auth-config.tmpl"),
 			workflow.Apply("vs-2.yaml"),
-			turnOnExtauthDebugLogging(),
+			gloo.CurlRedirect("/", issuerHost),
+			gloo.RestoreLogLevel(gloo.ExtauthLogging),
 
 			// Make sure everything is healthy
 			gloo.GlooctlCheck(),
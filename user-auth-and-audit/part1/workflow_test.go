@@ -4,17 +4,13 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/solo-io/gloo-ref-arch/user-auth-and-audit/part1"
-	"github.com/solo-io/go-utils/testutils"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"testing"
 )
 
 func TestUserAuthAndAuditing(t *testing.T) {
-	RegisterFailHandler(Fail)
-	testutils.RegisterPreFailHandler(
-		func() {
-			testutils.PrintTrimmedStack()
-		})
-	testutils.RegisterCommonFailHandlers()
+	diagnostics.RegisterFailHandlers(".")
 	RunSpecs(t, "User Auth and Auditing")
 }
 
@@ -25,6 +21,11 @@ var _ = Describe("Part 1", func() {
 		testWorkflow.Setup(".")
 	})
 
+	// The workflow restores the extauth log level when it passes, and this restores it when it fails first.
+	AfterSuite(func() {
+		Expect(gloo.RestoreLogLevels(".")).To(Succeed())
+	})
+
 	It("runs", func() {
 		testWorkflow.Run(".")
 	})
@@ -0,0 +1,174 @@
+package part2
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+	"github.com/solo-io/valet/pkg/render"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/helm"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// The last codecentric/keycloak chart with the keycloak-values.yaml layout.
+	keycloakChart = "https://github.com/codecentric/helm-charts/releases/download/keycloak-8.2.2/keycloak-8.2.2.tgz"
+
+	// Keycloak and the app are addressed by their in-cluster hosts, so that the issuer and redirect URLs are the same
+	// for extauth and for the login, which reaches them through port-forwards.
+	keycloakHost  = "keycloak-http.keycloak.svc.cluster.local:8080"
+	glooProxyHost = "gateway-proxy.gloo-system.svc.cluster.local"
+
+	clientId     = "demo-oidc"
+	clientSecret = "demo-oidc-secret"
+
+	// The demo users in realm.json. Only the allowed one has the email that allow-jwt.yaml permits.
+	allowedUser  = "demo-allowed"
+	deniedUser   = "demo-denied"
+	userPassword = "demo-password"
+)
+
+// Values for the realm.json placeholders. Logins go through the realm's own users, so the Google identity
+// provider is imported with placeholder credentials.
+var realmValues = map[string]string{
+	"GoogleClientId":       "unused",
+	"GoogleClientSecret":   "unused",
+	"KeycloakClientId":     clientId,
+	"KeycloakClientSecret": clientSecret,
+	"GlooProxyIp":          glooProxyHost,
+	"DemoUserPassword":     userPassword,
+}
+
+// realm.json is imported by Keycloak from a secret, so it is rendered into the secret rather than applied.
+func createRealmSecret() *workflow.Step {
+	var keys []string
+	for key := range realmValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var substitutions []string
+	for _, key := range keys {
+		substitutions = append(substitutions, fmt.Sprintf(`-e 's#{{ \.%s }}#%s#g'`, key, realmValues[key]))
+	}
+	lines := []string{
+		"set -e",
+		"kubectl create namespace keycloak --dry-run=client -o yaml | kubectl apply -f -",
+		fmt.Sprintf("sed %s realm.json | kubectl create secret generic realm-secret -n keycloak --from-file=realm.json=/dev/stdin --dry-run=client -o yaml | kubectl apply -f -",
+			strings.Join(substitutions, " ")),
+	}
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+func installKeycloak() *workflow.Step {
+	return &workflow.Step{
+		InstallHelmChart: &helm.InstallHelmChart{
+			ReleaseName: "keycloak",
+			ReleaseUri:  cluster.Chart(keycloakChart),
+			Namespace:   "keycloak",
+			ValuesFiles: []string{"keycloak-values.yaml"},
+		},
+	}
+}
+
+// Keycloak takes a while to start and import the realm.
+func waitForKeycloak() *workflow.Step {
+	return &workflow.Step{
+		Condition: &check.Condition{
+			Type:      "statefulset",
+			Name:      "keycloak",
+			Namespace: "keycloak",
+			Jsonpath:  "{.status.readyReplicas}",
+			Value:     "1",
+			Timeout:   "300s",
+		},
+	}
+}
+
+func loginAs(username string, statusCode int) *workflow.Step {
+	return login.Login{
+		Url:        fmt.Sprintf("http://%s:80/", glooProxyHost),
+		Username:   username,
+		Password:   userPassword,
+		StatusCode: statusCode,
+		// OPA runs after the oauth config, so Gloo sets the session cookie for denied users too
+		SessionCookie: login.GlooSessionCookie,
+		CallbackPath:  "/callback",
+		PortForwards: []login.PortForward{
+			{
+				Host:      glooProxyHost + ":80",
+				Namespace: "gloo-system",
+				Resource:  "deploy/gateway-proxy",
+				Port:      8080,
+				LocalPort: 18080,
+			},
+			{
+				Host:      keycloakHost,
+				Namespace: "keycloak",
+				Resource:  "svc/keycloak-http",
+				Port:      8080,
+				LocalPort: 18081,
+			},
+		},
+	}.Step()
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		Values: render.Values{
+			"ClientSecret":     clientSecret,
+			"KeycloakClientId": clientId,
+			"KeycloakHost":     keycloakHost,
+			"GlooProxyIp":      glooProxyHost,
+		},
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.InstallGlooEnterprise(),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Install Keycloak with the demo realm
+			createRealmSecret(),
+			installKeycloak(),
+			waitForKeycloak(),
+
+			// Part 2: Deploy the monolith from part 1
+			workflow.Apply("../part1/petclinic.yaml").WithId("deploy-monolith"),
+			workflow.WaitForPods("default").WithId("wait-monolith"),
+			gloo.WaitForDiscoveredUpstream("default", "petclinic", 8080),
+
+			// Part 3: Deploy auth configs, and protect the route with Keycloak and OPA
+			workflow.ApplyTemplate("oauth-secret.tmpl"),
+			workflow.Apply("allow-jwt.yaml"),
+			workflow.ApplyTemplate("auth-config.tmpl"),
+			workflow.Apply("vs-2.yaml"),
+
+			// Part 4: Log in, as a user that OPA allows, and as one that it denies
+			loginAs(allowedUser, 200),
+			loginAs(deniedUser, 403),
+
+			// Make sure everything is healthy
+			gloo.GlooctlCheck(),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
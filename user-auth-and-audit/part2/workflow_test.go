@@ -0,0 +1,25 @@
+package part2_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/user-auth-and-audit/part2"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"testing"
+)
+
+func TestUserAuthAndAuditing(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "User Auth and Auditing Part 2")
+}
+
+var _ = Describe("Part 2", func() {
+	testWorkflow := part2.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("runs", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -0,0 +1,144 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	accesslogdata "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v2"
+	als "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	"google.golang.org/grpc"
+)
+
+// An Entry is the subset of an Envoy HTTP access log entry that workflows assert on.
+type Entry struct {
+	LogName         string `json:"logName"`
+	Method          string `json:"method"`
+	Authority       string `json:"authority"`
+	Path            string `json:"path"`
+	Protocol        string `json:"protocol"`
+	ResponseCode    uint32 `json:"responseCode"`
+	UpstreamCluster string `json:"upstreamCluster"`
+}
+
+// A Filter selects entries. Empty fields match everything.
+type Filter struct {
+	LogName      string
+	Method       string
+	Path         string
+	ResponseCode uint32
+}
+
+func (f Filter) Matches(e Entry) bool {
+	return (f.LogName == "" || f.LogName == e.LogName) &&
+		(f.Method == "" || f.Method == e.Method) &&
+		(f.Path == "" || f.Path == e.Path) &&
+		(f.ResponseCode == 0 || f.ResponseCode == e.ResponseCode)
+}
+
+// Server implements the Envoy access log service (envoy.service.accesslog.v2), storing HTTP
+// entries in memory. Entries are exposed over HTTP so that workflows can assert on them with curl.
+type Server struct {
+	lock    sync.RWMutex
+	entries []Entry
+}
+
+var _ als.AccessLogServiceServer = new(Server)
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+func (s *Server) Register(grpcServer *grpc.Server) {
+	als.RegisterAccessLogServiceServer(grpcServer, s)
+}
+
+func (s *Server) StreamAccessLogs(stream als.AccessLogService_StreamAccessLogsServer) error {
+	// Envoy only sends the identifier on the first message of each stream.
+	logName := ""
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&als.StreamAccessLogsResponse{})
+		}
+		if err != nil {
+			return err
+		}
+		if msg.GetIdentifier() != nil {
+			logName = msg.GetIdentifier().GetLogName()
+		}
+		for _, entry := range msg.GetHttpLogs().GetLogEntry() {
+			s.add(toEntry(logName, entry))
+		}
+	}
+}
+
+func (s *Server) add(entry Entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *Server) Entries(filter Filter) []Entry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := []Entry{}
+	for _, entry := range s.entries {
+		if filter.Matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = nil
+}
+
+// ServeHTTP lists entries on GET /entries, filtered by the logName, method, path and responseCode
+// query parameters, and clears them on DELETE /entries.
+func (s *Server) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/entries" {
+		http.NotFound(w, request)
+		return
+	}
+	switch request.Method {
+	case http.MethodGet:
+		query := request.URL.Query()
+		filter := Filter{
+			LogName: query.Get("logName"),
+			Method:  query.Get("method"),
+			Path:    query.Get("path"),
+		}
+		if code := query.Get("responseCode"); code != "" {
+			parsed, err := strconv.ParseUint(code, 10, 32)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.ResponseCode = uint32(parsed)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Entries(filter))
+	case http.MethodDelete:
+		s.Reset()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func toEntry(logName string, entry *accesslogdata.HTTPAccessLogEntry) Entry {
+	return Entry{
+		LogName:         logName,
+		Method:          entry.GetRequest().GetRequestMethod().String(),
+		Authority:       entry.GetRequest().GetAuthority(),
+		Path:            entry.GetRequest().GetPath(),
+		Protocol:        entry.GetProtocolVersion().String(),
+		ResponseCode:    entry.GetResponse().GetResponseCode().GetValue(),
+		UpstreamCluster: entry.GetCommonProperties().GetUpstreamCluster(),
+	}
+}
@@ -0,0 +1,127 @@
+package accesslog_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	accesslogdata "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v2"
+	als "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/accesslog"
+	"google.golang.org/grpc"
+)
+
+func TestAccessLog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Access Log Receiver Suite")
+}
+
+func httpEntry(method core.RequestMethod, path string, code uint32) *accesslogdata.HTTPAccessLogEntry {
+	return &accesslogdata.HTTPAccessLogEntry{
+		ProtocolVersion: accesslogdata.HTTPAccessLogEntry_HTTP11,
+		CommonProperties: &accesslogdata.AccessLogCommon{
+			UpstreamCluster: "default-petclinic-8080_gloo-system",
+		},
+		Request: &accesslogdata.HTTPRequestProperties{
+			RequestMethod: method,
+			Authority:     "petclinic.example.com",
+			Path:          path,
+		},
+		Response: &accesslogdata.HTTPResponseProperties{
+			ResponseCode: &wrappers.UInt32Value{Value: code},
+		},
+	}
+}
+
+var _ = Describe("Access log receiver", func() {
+	var (
+		server     *accesslog.Server
+		grpcServer *grpc.Server
+		conn       *grpc.ClientConn
+	)
+
+	BeforeEach(func() {
+		server = accesslog.NewServer()
+		grpcServer = grpc.NewServer()
+		server.Register(grpcServer)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go grpcServer.Serve(lis)
+		conn, err = grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		grpcServer.Stop()
+	})
+
+	send := func(logName string, batches ...[]*accesslogdata.HTTPAccessLogEntry) {
+		stream, err := als.NewAccessLogServiceClient(conn).StreamAccessLogs(context.TODO())
+		Expect(err).To(BeNil())
+		for i, batch := range batches {
+			msg := &als.StreamAccessLogsMessage{
+				LogEntries: &als.StreamAccessLogsMessage_HttpLogs{
+					HttpLogs: &als.StreamAccessLogsMessage_HTTPAccessLogEntries{LogEntry: batch},
+				},
+			}
+			if i == 0 {
+				msg.Identifier = &als.StreamAccessLogsMessage_Identifier{LogName: logName}
+			}
+			Expect(stream.Send(msg)).To(BeNil())
+		}
+		_, err = stream.CloseAndRecv()
+		Expect(err).To(BeNil())
+	}
+
+	It("stores entries and keeps the log name across messages in a stream", func() {
+		send("example",
+			[]*accesslogdata.HTTPAccessLogEntry{httpEntry(core.RequestMethod_GET, "/", 200)},
+			[]*accesslogdata.HTTPAccessLogEntry{httpEntry(core.RequestMethod_POST, "/owners", 302)})
+		send("other", []*accesslogdata.HTTPAccessLogEntry{httpEntry(core.RequestMethod_GET, "/vets.html", 200)})
+
+		Eventually(func() []accesslog.Entry {
+			return server.Entries(accesslog.Filter{})
+		}).Should(HaveLen(3))
+		Expect(server.Entries(accesslog.Filter{LogName: "example"})).To(Equal([]accesslog.Entry{
+			{LogName: "example", Method: "GET", Authority: "petclinic.example.com", Path: "/", Protocol: "HTTP11", ResponseCode: 200, UpstreamCluster: "default-petclinic-8080_gloo-system"},
+			{LogName: "example", Method: "POST", Authority: "petclinic.example.com", Path: "/owners", Protocol: "HTTP11", ResponseCode: 302, UpstreamCluster: "default-petclinic-8080_gloo-system"},
+		}))
+		Expect(server.Entries(accesslog.Filter{ResponseCode: 200})).To(HaveLen(2))
+	})
+
+	It("serves and clears entries over http", func() {
+		send("example", []*accesslogdata.HTTPAccessLogEntry{
+			httpEntry(core.RequestMethod_GET, "/", 200),
+			httpEntry(core.RequestMethod_GET, "/vets.html", 503),
+		})
+		Eventually(func() []accesslog.Entry {
+			return server.Entries(accesslog.Filter{})
+		}).Should(HaveLen(2))
+
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		resp, err := http.Get(httpServer.URL + "/entries?logName=example&path=/vets.html")
+		Expect(err).To(BeNil())
+		var entries []accesslog.Entry
+		Expect(json.NewDecoder(resp.Body).Decode(&entries)).To(BeNil())
+		resp.Body.Close()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].ResponseCode).To(Equal(uint32(503)))
+
+		req, err := http.NewRequest(http.MethodDelete, httpServer.URL+"/entries", nil)
+		Expect(err).To(BeNil())
+		resp, err = http.DefaultClient.Do(req)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(server.Entries(accesslog.Filter{})).To(BeEmpty())
+	})
+})
@@ -0,0 +1,75 @@
+package bash
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// A PortForward exposes a port of a resource in the cluster on a local port, for the rest of a step's script.
+// The caller chooses the local port, e.g. the one URLs in the step expect, so it has to be free on the machine
+// running the workflow.
+type PortForward struct {
+	Namespace string
+	// e.g. deploy/gateway-proxy or svc/keycloak-http
+	Resource  string
+	Port      int
+	LocalPort int
+}
+
+// GatewayProxy port-forwards a port of the gateway-proxy deployment, e.g. its http listener on 8080.
+func GatewayProxy(port, localPort int) PortForward {
+	return PortForward{Namespace: "gloo-system", Resource: "deploy/gateway-proxy", Port: port, LocalPort: localPort}
+}
+
+// PortForwardLines starts the port-forwards in the background, and stops them when the script exits.
+func PortForwardLines(forwards ...PortForward) []string {
+	lines := []string{"pids=()"}
+	for _, pf := range forwards {
+		lines = append(lines,
+			fmt.Sprintf("kubectl port-forward -n %s %s %d:%d >/dev/null 2>&1 &", pf.Namespace, pf.Resource, pf.LocalPort, pf.Port),
+			"pids+=($!)")
+	}
+	return append(lines, `trap 'kill ${pids[@]} 2>/dev/null' EXIT`)
+}
+
+// RetryLines runs the attempt lines until they exit the script, which they do once what they check passes, up to
+// attempts times, delay seconds apart. If they never do, it says what it timed out waiting for, and runs the lines
+// that show the last attempt before failing.
+func RetryLines(attempts, delay int, attempt []string, description string, lastAttempt ...string) []string {
+	lines := []string{fmt.Sprintf("for i in $(seq %d); do", attempts)}
+	for _, line := range attempt {
+		lines = append(lines, "  "+line)
+	}
+	lines = append(lines,
+		fmt.Sprintf("  sleep %d", delay),
+		"done",
+		fmt.Sprintf("echo %s", Quote("Timed out waiting: "+description)))
+	lines = append(lines, lastAttempt...)
+	return append(lines, "exit 1")
+}
+
+// Quote single-quotes a string for bash, so that it is passed on as is.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// GoCommand returns a line that builds a command from a package in this repo, e.g. utils/login/cmd, into _output/bin
+// in the repo root, and the path to run it with. Workflows run with go test, so the Go toolchain is there; building
+// once per step, rather than go run, keeps retries from relinking it on every attempt.
+func GoCommand(name, pkg string) (build, command string) {
+	command = fmt.Sprintf(`"$(git rev-parse --show-toplevel)/_output/bin/%s"`, name)
+	build = fmt.Sprintf(`go build -o %s "$(git rev-parse --show-toplevel)/%s"`, command, pkg)
+	return build, command
+}
+
+// Step runs the lines as a bash script.
+func Step(lines ...string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
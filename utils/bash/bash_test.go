@@ -0,0 +1,55 @@
+package bash_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+)
+
+func TestBash(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bash Suite")
+}
+
+func run(lines ...string) (string, error) {
+	out, err := exec.Command("bash", "-c", strings.Join(lines, "\n")).CombinedOutput()
+	return string(out), err
+}
+
+var _ = Describe("Bash scripts", func() {
+
+	It("retries until an attempt exits", func() {
+		out, err := run(append([]string{"n=0"}, bash.RetryLines(5, 0, []string{
+			"n=$((n + 1))",
+			`if [ $n -eq 3 ]; then echo "passed on attempt $n"; exit 0; fi`,
+		}, "the third attempt")...)...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("passed on attempt 3\n"))
+	})
+
+	It("shows the last attempt when it times out", func() {
+		out, err := run(append([]string{"n=0"}, bash.RetryLines(2, 0, []string{
+			"n=$((n + 1))",
+		}, "something that doesn't happen", `echo "last attempt was $n"`)...)...)
+		Expect(err).To(HaveOccurred())
+		Expect(out).To(Equal("Timed out waiting: something that doesn't happen\nlast attempt was 2\n"))
+	})
+
+	It("port-forwards from the local port, and stops port-forwarding when the script exits", func() {
+		lines := bash.PortForwardLines(bash.GatewayProxy(8080, 18080), bash.PortForward{
+			Namespace: "keycloak", Resource: "svc/keycloak-http", Port: 8080, LocalPort: 18081,
+		})
+		Expect(lines).To(Equal([]string{
+			"pids=()",
+			"kubectl port-forward -n gloo-system deploy/gateway-proxy 18080:8080 >/dev/null 2>&1 &",
+			"pids+=($!)",
+			"kubectl port-forward -n keycloak svc/keycloak-http 18081:8080 >/dev/null 2>&1 &",
+			"pids+=($!)",
+			`trap 'kill ${pids[@]} 2>/dev/null' EXIT`,
+		}))
+	})
+})
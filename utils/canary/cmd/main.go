@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/canary"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+type weightsFlag []int
+
+func (w *weightsFlag) String() string {
+	return fmt.Sprint([]int(*w))
+}
+
+func (w *weightsFlag) Set(value string) error {
+	*w = nil
+	for _, part := range strings.Split(value, ",") {
+		weight, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("expected comma separated weights, got %s", value)
+		}
+		*w = append(*w, weight)
+	}
+	return nil
+}
+
+type headerFlag charts.HeaderMatcher
+
+func (h *headerFlag) String() string {
+	return fmt.Sprintf("%s=%s", h.Name, h.Value)
+}
+
+func (h *headerFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected NAME=VALUE, got %s", value)
+	}
+	h.Name, h.Value = parts[0], parts[1]
+	return nil
+}
+
+// Runs a canary rollout on the cluster kubectl is configured for, judging the canary by Envoy's stats on the
+// gateway-proxy admin port, e.g. port-forwarded with `kubectl port-forward -n gloo-system deploy/gateway-proxy 19000`.
+// Exits non-zero if the rollout doesn't end as expected, printing what the canary served in each phase.
+func main() {
+	rollout := canary.Rollout{
+		Header:  charts.HeaderMatcher{Name: "stage", Value: "canary"},
+		Weights: []int{10, 25, 50, 100},
+	}
+	var domains string
+	flag.StringVar(&rollout.VirtualService.Name, "virtual-service", "", "name of the virtual service the rollout replaces the routes of")
+	flag.StringVar(&rollout.VirtualService.Namespace, "virtual-service-namespace", "gloo-system", "namespace of the virtual service")
+	flag.StringVar(&domains, "domains", "*", "comma separated domains of the virtual service")
+	flag.StringVar(&rollout.Prefix, "prefix", "/", "prefix to route to the upstream")
+	flag.StringVar(&rollout.Upstream.Name, "upstream", "", "name of the upstream with the primary and canary subsets")
+	flag.StringVar(&rollout.Upstream.Namespace, "upstream-namespace", "gloo-system", "namespace of the upstream")
+	flag.StringVar(&rollout.SubsetKey, "subset-key", canary.DefaultSubsetKey, "pod label the upstream's subsets are selected by")
+	flag.StringVar(&rollout.Primary, "primary", "", "subset label value of the primary, e.g. v1")
+	flag.StringVar(&rollout.Canary, "canary", "", "subset label value of the canary, e.g. v2")
+	flag.Var((*headerFlag)(&rollout.Header), "header", "NAME=VALUE of the header that routes requests to the canary in the first phase")
+	flag.Var((*weightsFlag)(&rollout.Weights), "weights", "comma separated percentages of traffic to shift to the canary, one phase each")
+	flag.DurationVar(&rollout.Interval, "interval", canary.DefaultInterval, "how long to watch the canary in each phase")
+	flag.IntVar(&rollout.MinRequests, "min-requests", canary.DefaultMinRequests, "requests the canary needs in a phase before it is judged")
+	flag.Float64Var(&rollout.ErrorBudget, "error-budget", canary.DefaultErrorBudget, "highest fraction of the canary's requests that may fail with a 5xx in a phase")
+	envoyAdmin := flag.String("envoy-admin", "http://localhost:19000", "URL of the gateway-proxy's Envoy admin API")
+	timeout := flag.Duration("timeout", 0, "time limit for the whole rollout, after which it is rolled back (0 for none)")
+	expect := flag.String("expect", string(canary.Promoted), fmt.Sprintf("expected outcome, %s or %s", canary.Promoted, canary.RolledBack))
+	flag.Parse()
+	rollout.Domains = strings.Split(domains, ",")
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	controller := canary.Controller{
+		Rollout: rollout,
+		Cluster: canary.Kubectl{},
+		Health:  &canary.EnvoyStats{AdminUrl: *envoyAdmin, Cluster: canary.ClusterName(rollout.Upstream)},
+		Logf:    log.Printf,
+	}
+	result, err := controller.Run(ctx)
+	if result != nil {
+		fmt.Println(result.Report())
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	if result == nil || string(result.Outcome) != *expect {
+		fmt.Printf("Expected the rollout of %s to be %s\n", rollout.Canary, *expect)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,147 @@
+package canary
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	errors "github.com/rotisserie/eris"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+const (
+	// Envoy's admin API lists per-host counters here, as cluster::host:port::stat::value lines.
+	clustersPath = "/clusters"
+
+	// Every request sent to a host, and the ones that got a 5xx response or failed to connect.
+	totalStat = "rq_total"
+	errorStat = "rq_error"
+
+	statsTimeout = 10 * time.Second
+)
+
+var (
+	EnvoyAdminError = func(url string, statusCode int) error {
+		return errors.Errorf("Envoy admin %s responded with status %d", url, statusCode)
+	}
+)
+
+// RequestCounts are the requests a subset got over some time, and how many of them failed.
+type RequestCounts struct {
+	Total  int
+	Errors int
+}
+
+func (c RequestCounts) Add(other RequestCounts) RequestCounts {
+	return RequestCounts{Total: c.Total + other.Total, Errors: c.Errors + other.Errors}
+}
+
+func (c RequestCounts) Sub(other RequestCounts) RequestCounts {
+	return RequestCounts{Total: c.Total - other.Total, Errors: c.Errors - other.Errors}
+}
+
+// ErrorRate is the fraction of the requests that failed, or 0 if there weren't any.
+func (c RequestCounts) ErrorRate() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Errors) / float64(c.Total)
+}
+
+func (c RequestCounts) String() string {
+	return fmt.Sprintf("%d/%d requests failed (%.1f%%)", c.Errors, c.Total, 100*c.ErrorRate())
+}
+
+// A HealthSignal counts the requests each subset has served so far, keyed by host address (ip:port). Counts only
+// ever go up, so the requests in a phase are the difference between two readings.
+type HealthSignal interface {
+	HostCounts(ctx context.Context) (map[string]RequestCounts, error)
+}
+
+// The name Gloo gives the Envoy cluster for an upstream.
+func ClusterName(upstream charts.ResourceRef) string {
+	return fmt.Sprintf("%s_%s", upstream.Name, upstream.Namespace)
+}
+
+// EnvoyStats reads the per-host counters of an upstream's cluster from Envoy's admin API, e.g. port-forwarded from
+// the gateway-proxy on localhost:19000. Envoy doesn't keep stats per subset, so the hosts are grouped by subset
+// afterwards, with the labels of the pods they belong to.
+type EnvoyStats struct {
+	AdminUrl string
+	Cluster  string
+}
+
+func (s *EnvoyStats) HostCounts(ctx context.Context) (map[string]RequestCounts, error) {
+	ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(s.AdminUrl, "/") + clustersPath
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting Envoy stats from %s", url)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, EnvoyAdminError(url, response.StatusCode)
+	}
+	return parseClusters(response.Body, s.Cluster)
+}
+
+// Cluster-wide lines, like echo_gloo-system::default_priority::max_connections::1024, are skipped, since only hosts
+// have an address.
+func parseClusters(r io.Reader, cluster string) (map[string]RequestCounts, error) {
+	result := make(map[string]RequestCounts)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "::")
+		if len(fields) != 4 || fields[0] != cluster {
+			continue
+		}
+		host, stat, value := fields[1], fields[2], fields[3]
+		if stat != totalStat && stat != errorStat {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s of %s", stat, host)
+		}
+		counts := result[host]
+		if stat == totalStat {
+			counts.Total = count
+		} else {
+			counts.Errors = count
+		}
+		result[host] = counts
+	}
+	return result, scanner.Err()
+}
+
+// SubsetCounts adds up the requests each host got since the earlier reading, by the subset the host is in. Hosts
+// that weren't in the earlier reading, like a new pod, count from zero.
+func SubsetCounts(before, after map[string]RequestCounts, subsets map[string]string) map[string]RequestCounts {
+	result := make(map[string]RequestCounts)
+	for host, counts := range after {
+		ip, _, err := net.SplitHostPort(host)
+		if err != nil {
+			continue
+		}
+		subset, ok := subsets[ip]
+		if !ok {
+			continue
+		}
+		result[subset] = result[subset].Add(counts.Sub(before[host]))
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package canary
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	errors "github.com/rotisserie/eris"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+var (
+	NotKubeUpstreamError = func(upstream charts.ResourceRef) error {
+		return errors.Errorf("Upstream %s in %s doesn't select kube pods", upstream.Name, upstream.Namespace)
+	}
+	KubectlError = func(args []string, output string) error {
+		return errors.Errorf("kubectl %s failed: %s", strings.Join(args, " "), strings.TrimSpace(output))
+	}
+)
+
+// A Cluster is where a rollout applies its virtual services, and finds the pods in each subset.
+type Cluster interface {
+	Apply(ctx context.Context, manifest []byte) error
+	// PodSubsets maps the IP of each pod the upstream selects to the value of its subset label, e.g. version.
+	PodSubsets(ctx context.Context, upstream charts.ResourceRef, subsetKey string) (map[string]string, error)
+}
+
+// Kubectl is the cluster kubectl is configured for, so the controller runs wherever the workflows do.
+type Kubectl struct{}
+
+func (Kubectl) Apply(ctx context.Context, manifest []byte) error {
+	_, err := kubectl(ctx, manifest, "apply", "-f", "-")
+	return err
+}
+
+func (Kubectl) PodSubsets(ctx context.Context, upstream charts.ResourceRef, subsetKey string) (map[string]string, error) {
+	out, err := kubectl(ctx, nil, "get", "upstreams.gloo.solo.io", "-n", upstream.Namespace, upstream.Name, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var us charts.Upstream
+	if err := yaml.Unmarshal(out, &us); err != nil {
+		return nil, errors.Wrapf(err, "decoding upstream %s", upstream.Name)
+	}
+	if us.Spec.Kube == nil {
+		return nil, NotKubeUpstreamError(upstream)
+	}
+
+	var selector []string
+	for name, value := range us.Spec.Kube.Selector {
+		selector = append(selector, name+"="+value)
+	}
+	sort.Strings(selector)
+	out, err = kubectl(ctx, nil, "get", "pods", "-n", us.Spec.Kube.ServiceNamespace, "-l", strings.Join(selector, ","), "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var pods struct {
+		Items []struct {
+			Metadata charts.Metadata `json:"metadata"`
+			Status   struct {
+				PodIP string `json:"podIP"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := yaml.Unmarshal(out, &pods); err != nil {
+		return nil, errors.Wrapf(err, "decoding pods for upstream %s", upstream.Name)
+	}
+	result := make(map[string]string)
+	for _, pod := range pods.Items {
+		subset, ok := pod.Metadata.Labels[subsetKey]
+		if ok && pod.Status.PodIP != "" {
+			result[pod.Status.PodIP] = subset
+		}
+	}
+	return result, nil
+}
+
+func kubectl(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := stderr.String()
+		if output == "" {
+			output = err.Error()
+		}
+		return nil, KubectlError(args, output)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,272 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	errors "github.com/rotisserie/eris"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+const (
+	DefaultSubsetKey   = "version"
+	DefaultInterval    = 10 * time.Second
+	DefaultErrorBudget = 0.05
+	DefaultMinRequests = 20
+
+	// A rollback still has to be applied when the rollout ran out of time.
+	rollbackTimeout = 30 * time.Second
+)
+
+var (
+	InvalidRolloutError = func(reason string) error {
+		return errors.Errorf("Invalid rollout: %s", reason)
+	}
+	ErrorBudgetExceededError = func(phase string, counts RequestCounts, budget float64) error {
+		return errors.Errorf("Rolled back to the primary: during %s, %s on the canary, over the error budget of %.1f%%",
+			phase, counts, 100*budget)
+	}
+	NotEnoughRequestsError = func(phase string, counts RequestCounts, minRequests int) error {
+		return errors.Errorf("Rolled back to the primary: during %s, the canary only got %d of the %d requests needed to judge it",
+			phase, counts.Total, minRequests)
+	}
+)
+
+type Outcome string
+
+const (
+	Promoted   Outcome = "promoted"
+	RolledBack Outcome = "rolled-back"
+)
+
+// A Rollout shifts the traffic for a prefix from the primary subset of an upstream to a canary, in two phases like
+// the two-phased canary series: first only requests with a header are routed to the canary, then a growing share
+// of all requests. The rollout owns the virtual service, and replaces its routes at each step.
+type Rollout struct {
+	VirtualService charts.ResourceRef
+	Domains        []string
+	Prefix         string
+
+	Upstream charts.ResourceRef
+	// The pod label the upstream's subsets are selected by, e.g. version.
+	SubsetKey string
+	Primary   string
+	Canary    string
+
+	// Requests with this header are routed to the canary from the first phase on, e.g. stage: canary.
+	Header charts.HeaderMatcher
+	// The percentages of traffic to shift to the canary, one phase each, e.g. 10, 25, 50, 100.
+	Weights []int
+
+	// How long to watch the canary in each phase. Phases are extended until the canary has had MinRequests.
+	Interval    time.Duration
+	MinRequests int
+	// The highest fraction of the canary's requests that may fail in a phase, e.g. 0.05.
+	ErrorBudget float64
+}
+
+func (r Rollout) Validate() error {
+	switch {
+	case r.Primary == "" || r.Canary == "":
+		return InvalidRolloutError("the primary and canary versions are required")
+	case r.Primary == r.Canary:
+		return InvalidRolloutError(fmt.Sprintf("the canary version %s is the same as the primary version", r.Canary))
+	case r.Header.Name == "":
+		return InvalidRolloutError("a header is required for the first phase")
+	case len(r.Weights) == 0:
+		return InvalidRolloutError("at least one weight is required")
+	case r.Interval <= 0:
+		return InvalidRolloutError("the interval must be positive")
+	case r.ErrorBudget < 0 || r.ErrorBudget > 1:
+		return InvalidRolloutError(fmt.Sprintf("the error budget %v must be between 0 and 1", r.ErrorBudget))
+	}
+	previous := 0
+	for _, weight := range r.Weights {
+		if weight <= previous || weight > 100 {
+			return InvalidRolloutError(fmt.Sprintf("the weights %v must increase, between 1 and 100", r.Weights))
+		}
+		previous = weight
+	}
+	return nil
+}
+
+func (r Rollout) destination(version string) charts.Destination {
+	return charts.Destination{
+		Upstream: r.Upstream,
+		Subset:   &charts.Subset{Values: map[string]string{r.SubsetKey: version}},
+	}
+}
+
+func (r Rollout) virtualService(routes ...charts.Route) charts.VirtualService {
+	return charts.VirtualService{
+		ApiVersion: "gateway.solo.io/v1",
+		Kind:       "VirtualService",
+		Metadata:   charts.Metadata{Name: r.VirtualService.Name, Namespace: r.VirtualService.Namespace},
+		Spec: charts.VirtualServiceSpec{
+			VirtualHost: charts.VirtualHost{Domains: r.Domains, Routes: routes},
+		},
+	}
+}
+
+// RouteTo sends all of the traffic to one version, like vs-2.yaml before the rollout, or vs-7.yaml after it.
+func (r Rollout) RouteTo(version string) charts.VirtualService {
+	destination := r.destination(version)
+	return r.virtualService(charts.Route{
+		Matchers:    []charts.Matcher{{Prefix: r.Prefix}},
+		RouteAction: &charts.RouteAction{Single: &destination},
+	})
+}
+
+// Split routes requests with the header to the canary, and splits the rest by weight, like vs-4.yaml (a weight of
+// 0) through vs-6.yaml (100).
+func (r Rollout) Split(canaryWeight int) charts.VirtualService {
+	canary := r.destination(r.Canary)
+	return r.virtualService(
+		charts.Route{
+			Matchers:    []charts.Matcher{{Prefix: r.Prefix, Headers: []charts.HeaderMatcher{r.Header}}},
+			RouteAction: &charts.RouteAction{Single: &canary},
+		},
+		charts.Route{
+			Matchers: []charts.Matcher{{Prefix: r.Prefix}},
+			RouteAction: &charts.RouteAction{Multi: &charts.MultiDestination{
+				Destinations: []charts.WeightedDestination{
+					{Destination: r.destination(r.Primary), Weight: 100 - canaryWeight},
+					{Destination: canary, Weight: canaryWeight},
+				},
+			}},
+		})
+}
+
+// A Phase is a step of the rollout, and what the canary served during it.
+type Phase struct {
+	Name         string
+	CanaryWeight int
+	Counts       RequestCounts
+}
+
+type Result struct {
+	Outcome Outcome
+	Phases  []Phase
+}
+
+func (r *Result) Report() string {
+	var lines []string
+	for _, phase := range r.Phases {
+		lines = append(lines, fmt.Sprintf("%s: %s", phase.Name, phase.Counts))
+	}
+	lines = append(lines, fmt.Sprintf("Outcome: %s", r.Outcome))
+	return strings.Join(lines, "\n")
+}
+
+// A Controller runs a rollout against a cluster, judging the canary in each phase by its 5xx rate in Envoy.
+type Controller struct {
+	Rollout Rollout
+	Cluster Cluster
+	Health  HealthSignal
+	// Reports progress, e.g. log.Printf. Optional.
+	Logf func(format string, args ...interface{})
+}
+
+func (c *Controller) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// Run applies each phase in turn, and promotes the canary once it has been healthy in all of them. If the canary
+// exceeds its error budget, doesn't get enough requests to judge before the context is done, or a phase can't be
+// applied, all of the traffic is routed back to the primary, and the result is returned with the reason.
+func (c *Controller) Run(ctx context.Context) (*Result, error) {
+	rollout := c.Rollout
+	if err := rollout.Validate(); err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	phases := []Phase{{Name: fmt.Sprintf("header %s=%s", rollout.Header.Name, rollout.Header.Value)}}
+	for _, weight := range rollout.Weights {
+		phases = append(phases, Phase{Name: fmt.Sprintf("weight %d", weight), CanaryWeight: weight})
+	}
+
+	for _, phase := range phases {
+		c.logf("Starting %s", phase.Name)
+		if err := c.apply(ctx, rollout.Split(phase.CanaryWeight)); err != nil {
+			return result, c.rollback(result, err)
+		}
+		counts, err := c.observe(ctx, phase.Name)
+		phase.Counts = counts
+		result.Phases = append(result.Phases, phase)
+		if err != nil {
+			return result, c.rollback(result, err)
+		}
+		c.logf("%s: %s", phase.Name, counts)
+		if counts.ErrorRate() > rollout.ErrorBudget {
+			return result, c.rollback(result, ErrorBudgetExceededError(phase.Name, counts, rollout.ErrorBudget))
+		}
+	}
+
+	c.logf("Promoting %s", rollout.Canary)
+	if err := c.apply(ctx, rollout.RouteTo(rollout.Canary)); err != nil {
+		return result, err
+	}
+	result.Outcome = Promoted
+	return result, nil
+}
+
+// Watches the canary for an interval, and longer if it didn't get enough requests.
+func (c *Controller) observe(ctx context.Context, phase string) (RequestCounts, error) {
+	rollout := c.Rollout
+	var counts RequestCounts
+	// Reading the stats fails too once the context is done, which means the canary never got enough requests.
+	failed := func(err error) (RequestCounts, error) {
+		if ctx.Err() != nil {
+			return counts, NotEnoughRequestsError(phase, counts, rollout.MinRequests)
+		}
+		return counts, err
+	}
+	before, err := c.Health.HostCounts(ctx)
+	if err != nil {
+		return failed(err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return failed(ctx.Err())
+		case <-time.After(rollout.Interval):
+		}
+		after, err := c.Health.HostCounts(ctx)
+		if err != nil {
+			return failed(err)
+		}
+		subsets, err := c.Cluster.PodSubsets(ctx, rollout.Upstream, rollout.SubsetKey)
+		if err != nil {
+			return failed(err)
+		}
+		counts = SubsetCounts(before, after, subsets)[rollout.Canary]
+		if counts.Total >= rollout.MinRequests {
+			return counts, nil
+		}
+		c.logf("%s: the canary has had %d of the %d requests needed, waiting", phase, counts.Total, rollout.MinRequests)
+	}
+}
+
+func (c *Controller) rollback(result *Result, reason error) error {
+	c.logf("Rolling back to %s: %v", c.Rollout.Primary, reason)
+	result.Outcome = RolledBack
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if err := c.apply(ctx, c.Rollout.RouteTo(c.Rollout.Primary)); err != nil {
+		return errors.Wrapf(err, "rolling back after: %v", reason)
+	}
+	return reason
+}
+
+func (c *Controller) apply(ctx context.Context, vs charts.VirtualService) error {
+	manifest, err := yaml.Marshal(vs)
+	if err != nil {
+		return err
+	}
+	return c.Cluster.Apply(ctx, manifest)
+}
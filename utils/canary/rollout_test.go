@@ -0,0 +1,307 @@
+package canary_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/canary"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+func TestCanary(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Canary Rollout Suite")
+}
+
+const part1 = "../../two-phased-canary/part1"
+
+var (
+	primaryHost = "10.0.0.1:8080"
+	canaryHost  = "10.0.0.2:8080"
+)
+
+// The part 1 echo app: a virtual service in front of an upstream with a subset for each version.
+func echoRollout() canary.Rollout {
+	return canary.Rollout{
+		VirtualService: charts.ResourceRef{Name: "echo", Namespace: "gloo-system"},
+		Domains:        []string{"*"},
+		Prefix:         "/",
+		Upstream:       charts.ResourceRef{Name: "echo", Namespace: "gloo-system"},
+		SubsetKey:      "version",
+		Primary:        "v1",
+		Canary:         "v2",
+		Header:         charts.HeaderMatcher{Name: "stage", Value: "canary"},
+		Weights:        []int{10, 50, 100},
+		Interval:       time.Millisecond,
+		MinRequests:    20,
+		ErrorBudget:    0.05,
+	}
+}
+
+// A cluster running the echo app behind a gateway. Every time Envoy's stats are read, the gateway has served another
+// batch of requests, a tenth of them with the canary header, and the rest split like the last virtual service
+// applied. The canary fails a percentage of its requests, like spelunker with an x-error-rate header, and can fail
+// another percentage once it gets at least half of the traffic.
+type fakeCluster struct {
+	lock               sync.Mutex
+	applied            []charts.VirtualService
+	counts             map[string]canary.RequestCounts
+	requestsPerRead    int
+	canaryErrorRate    int
+	errorRateUnderLoad int
+}
+
+func newFakeCluster(canaryErrorRate int) *fakeCluster {
+	return &fakeCluster{
+		counts:          make(map[string]canary.RequestCounts),
+		requestsPerRead: 100,
+		canaryErrorRate: canaryErrorRate,
+	}
+}
+
+func (c *fakeCluster) Apply(ctx context.Context, manifest []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var vs charts.VirtualService
+	if err := yaml.Unmarshal(manifest, &vs); err != nil {
+		return err
+	}
+	c.applied = append(c.applied, vs)
+	return nil
+}
+
+func (c *fakeCluster) PodSubsets(ctx context.Context, upstream charts.ResourceRef, subsetKey string) (map[string]string, error) {
+	return map[string]string{"10.0.0.1": "v1", "10.0.0.2": "v2"}, nil
+}
+
+func (c *fakeCluster) last() charts.VirtualService {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.applied[len(c.applied)-1]
+}
+
+func (c *fakeCluster) hostFor(destination *charts.Destination) string {
+	if destination.Subset.Values["version"] == "v2" {
+		return canaryHost
+	}
+	return primaryHost
+}
+
+func (c *fakeCluster) serve() {
+	if len(c.applied) == 0 {
+		return
+	}
+	sent := map[string]int{}
+	errorRate := c.canaryErrorRate
+	header := c.requestsPerRead / 10
+	for _, route := range c.applied[len(c.applied)-1].Spec.VirtualHost.Routes {
+		action := route.RouteAction
+		if len(route.Matchers[0].Headers) > 0 {
+			sent[c.hostFor(action.Single)] += header
+		} else if action.Single != nil {
+			sent[c.hostFor(action.Single)] += c.requestsPerRead - header
+		} else {
+			for _, weighted := range action.Multi.Destinations {
+				host := c.hostFor(&weighted.Destination)
+				sent[host] += (c.requestsPerRead - header) * weighted.Weight / 100
+				if host == canaryHost && weighted.Weight >= 50 {
+					errorRate += c.errorRateUnderLoad
+				}
+			}
+		}
+	}
+	for host, requests := range sent {
+		counts := c.counts[host]
+		counts.Total += requests
+		if host == canaryHost {
+			counts.Errors += requests * errorRate / 100
+		}
+		c.counts[host] = counts
+	}
+}
+
+// Serves Envoy's /clusters admin endpoint for the echo upstream's cluster.
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.serve()
+	fmt.Fprintln(w, "echo_gloo-system::default_priority::max_connections::1024")
+	fmt.Fprintln(w, "echo_gloo-system::added_via_api::true")
+	for host, counts := range c.counts {
+		fmt.Fprintf(w, "echo_gloo-system::%s::cx_total::1\n", host)
+		fmt.Fprintf(w, "echo_gloo-system::%s::rq_error::%d\n", host, counts.Errors)
+		fmt.Fprintf(w, "echo_gloo-system::%s::rq_total::%d\n", host, counts.Total)
+		fmt.Fprintf(w, "other_gloo-system::%s::rq_total::1000\n", host)
+	}
+}
+
+func readVirtualService(file string) charts.VirtualService {
+	b, err := ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	var vs charts.VirtualService
+	Expect(yaml.Unmarshal(b, &vs)).To(Succeed())
+	return vs
+}
+
+var _ = Describe("Canary rollout", func() {
+
+	var (
+		cluster *fakeCluster
+		envoy   *httptest.Server
+	)
+
+	run := func(rollout canary.Rollout, timeout time.Duration) (*canary.Result, error) {
+		envoy = httptest.NewServer(cluster)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		controller := canary.Controller{
+			Rollout: rollout,
+			Cluster: cluster,
+			Health:  &canary.EnvoyStats{AdminUrl: envoy.URL, Cluster: canary.ClusterName(rollout.Upstream)},
+		}
+		return controller.Run(ctx)
+	}
+
+	AfterEach(func() {
+		if envoy != nil {
+			envoy.Close()
+		}
+	})
+
+	It("routes like the part 1 virtual services", func() {
+		rollout := echoRollout()
+		Expect(rollout.RouteTo("v1")).To(Equal(readVirtualService(part1 + "/vs-2.yaml")))
+		Expect(rollout.Split(0)).To(Equal(readVirtualService(part1 + "/vs-4.yaml")))
+		Expect(rollout.Split(50)).To(Equal(readVirtualService(part1 + "/vs-5.yaml")))
+		Expect(rollout.Split(100)).To(Equal(readVirtualService(part1 + "/vs-6.yaml")))
+		Expect(rollout.RouteTo("v2")).To(Equal(readVirtualService(part1 + "/vs-7.yaml")))
+	})
+
+	It("promotes a healthy canary after shifting through each weight", func() {
+		cluster = newFakeCluster(0)
+		rollout := echoRollout()
+		result, err := run(rollout, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Outcome).To(Equal(canary.Promoted))
+		Expect(cluster.applied).To(Equal([]charts.VirtualService{
+			rollout.Split(0), rollout.Split(10), rollout.Split(50), rollout.Split(100), rollout.RouteTo("v2"),
+		}))
+		var names []string
+		for _, phase := range result.Phases {
+			names = append(names, phase.Name)
+		}
+		Expect(names).To(Equal([]string{"header stage=canary", "weight 10", "weight 50", "weight 100"}))
+		// A tenth of a batch has the header, so the first phase waits for a second batch, and then the canary gets
+		// its share of the rest too
+		Expect(result.Phases[0].Counts).To(Equal(canary.RequestCounts{Total: 20}))
+		Expect(result.Phases[2].Counts).To(Equal(canary.RequestCounts{Total: 55}))
+	})
+
+	It("tolerates errors within the budget", func() {
+		// Like spelunker with x-error-rate: 0, which still fails about 1% of requests
+		cluster = newFakeCluster(1)
+		cluster.requestsPerRead = 1000
+		result, err := run(echoRollout(), 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Outcome).To(Equal(canary.Promoted))
+		Expect(result.Phases[0].Counts).To(Equal(canary.RequestCounts{Total: 100, Errors: 1}))
+	})
+
+	It("rolls back to the primary when the canary exceeds the error budget", func() {
+		cluster = newFakeCluster(20)
+		rollout := echoRollout()
+		result, err := run(rollout, 5*time.Second)
+		Expect(err).To(MatchError(
+			"Rolled back to the primary: during header stage=canary, 4/20 requests failed (20.0%) on the canary, over the error budget of 5.0%"))
+		Expect(result.Outcome).To(Equal(canary.RolledBack))
+		Expect(result.Phases).To(HaveLen(1))
+		Expect(cluster.applied).To(Equal([]charts.VirtualService{rollout.Split(0), rollout.RouteTo("v1")}))
+	})
+
+	It("rolls back when the canary only starts failing once it gets half of the traffic", func() {
+		cluster = newFakeCluster(0)
+		cluster.errorRateUnderLoad = 10
+		rollout := echoRollout()
+		result, err := run(rollout, 5*time.Second)
+		Expect(err).To(MatchError(
+			"Rolled back to the primary: during weight 50, 5/55 requests failed (9.1%) on the canary, over the error budget of 5.0%"))
+		Expect(result.Outcome).To(Equal(canary.RolledBack))
+		Expect(result.Phases).To(HaveLen(3))
+		Expect(cluster.last()).To(Equal(rollout.RouteTo("v1")))
+	})
+
+	It("waits for enough requests, and rolls back if the canary never gets them", func() {
+		cluster = newFakeCluster(0)
+		cluster.requestsPerRead = 10
+		rollout := echoRollout()
+		rollout.MinRequests = 1000
+		result, err := run(rollout, 100*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("Rolled back to the primary: during header stage=canary, the canary only got"))
+		Expect(result.Outcome).To(Equal(canary.RolledBack))
+		Expect(cluster.last()).To(Equal(rollout.RouteTo("v1")))
+	})
+
+	It("rejects weights that don't increase to at most 100", func() {
+		cluster = newFakeCluster(0)
+		for _, weights := range [][]int{{50, 25}, {10, 110}, {0, 50}, {}} {
+			rollout := echoRollout()
+			rollout.Weights = weights
+			_, err := run(rollout, time.Second)
+			Expect(err).To(HaveOccurred(), fmt.Sprint(weights))
+			Expect(err.Error()).To(HavePrefix("Invalid rollout"))
+		}
+		Expect(cluster.applied).To(BeEmpty())
+	})
+
+	It("counts requests from zero for hosts that weren't there before", func() {
+		before := map[string]canary.RequestCounts{"10.0.0.1:8080": {Total: 100, Errors: 1}}
+		after := map[string]canary.RequestCounts{
+			"10.0.0.1:8080": {Total: 150, Errors: 1},
+			"10.0.0.2:8080": {Total: 20, Errors: 5},
+			"10.0.0.3:8080": {Total: 10, Errors: 0},
+			"10.0.0.9:8080": {Total: 500, Errors: 500},
+		}
+		subsets := map[string]string{"10.0.0.1": "v1", "10.0.0.2": "v2", "10.0.0.3": "v2"}
+		Expect(canary.SubsetCounts(before, after, subsets)).To(Equal(map[string]canary.RequestCounts{
+			"v1": {Total: 50},
+			"v2": {Total: 30, Errors: 5},
+		}))
+	})
+
+	It("reads per-host counters for the upstream's cluster from Envoy", func() {
+		cluster = newFakeCluster(0)
+		cluster.counts[primaryHost] = canary.RequestCounts{Total: 7, Errors: 2}
+		envoy = httptest.NewServer(cluster)
+		stats := canary.EnvoyStats{AdminUrl: envoy.URL, Cluster: "echo_gloo-system"}
+		counts, err := stats.HostCounts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts).To(Equal(map[string]canary.RequestCounts{primaryHost: {Total: 7, Errors: 2}}))
+	})
+
+	It("runs the rollout from a workflow with traffic through the gateway", func() {
+		rollout := echoRollout()
+		rollout.Interval = 10 * time.Second
+		step := rollout.Step(canary.Traffic{Path: "/", Headers: map[string]string{"x-error-rate": "50"}}, canary.RolledBack)
+		Expect(step.Bash.Inline).To(ContainSubstring(
+			"while true; do curl -s -o /dev/null -H 'x-error-rate: 50' -H 'stage: canary' http://localhost:8080/; done &"))
+		lines := strings.Split(step.Bash.Inline, "\n")
+		Expect(lines[0]).To(Equal(
+			`go build -o "$(git rev-parse --show-toplevel)/_output/bin/rollout" "$(git rev-parse --show-toplevel)/utils/canary/cmd" || exit 1`))
+		Expect(lines).To(ContainElement(
+			`"$(git rev-parse --show-toplevel)/_output/bin/rollout" --virtual-service echo --virtual-service-namespace gloo-system ` +
+				`--domains '*' --prefix / --upstream echo --upstream-namespace gloo-system --subset-key version --primary v1 --canary v2 ` +
+				`--header 'stage=canary' --weights 10,50,100 --interval 10s --min-requests 20 --error-budget 0.05 ` +
+				`--envoy-admin http://localhost:19000 --timeout 5m0s --expect rolled-back`))
+	})
+})
@@ -0,0 +1,88 @@
+package canary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+var buildRolloutCommand, rolloutCommand = bash.GoCommand("rollout", "utils/canary/cmd")
+
+const (
+	gatewayHttpPort = 8080
+	envoyAdminPort  = 19000
+	// Rollouts in workflows are rolled back if they take longer than this, instead of hanging the workflow.
+	stepTimeout = 5 * time.Minute
+)
+
+// Traffic is what a workflow sends through the gateway while a rollout runs, since the canary is only judged by the
+// requests it gets. Requests are sent with and without the rollout's header, so the canary gets some in every phase.
+type Traffic struct {
+	Path string
+	// Sent with every request, e.g. x-error-rate to make spelunker fail some of them.
+	Headers map[string]string
+}
+
+func (t Traffic) curl(extraHeader string) string {
+	var names []string
+	for name := range t.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{"curl -s -o /dev/null"}
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("-H '%s: %s'", name, t.Headers[name]))
+	}
+	if extraHeader != "" {
+		args = append(args, fmt.Sprintf("-H '%s'", extraHeader))
+	}
+	args = append(args, fmt.Sprintf("http://localhost:%d%s", gatewayHttpPort, t.Path))
+	return strings.Join(args, " ")
+}
+
+func (r Rollout) command(expect Outcome) string {
+	var weights []string
+	for _, weight := range r.Weights {
+		weights = append(weights, fmt.Sprint(weight))
+	}
+	return strings.Join([]string{
+		rolloutCommand,
+		fmt.Sprintf("--virtual-service %s", r.VirtualService.Name),
+		fmt.Sprintf("--virtual-service-namespace %s", r.VirtualService.Namespace),
+		fmt.Sprintf("--domains '%s'", strings.Join(r.Domains, ",")),
+		fmt.Sprintf("--prefix %s", r.Prefix),
+		fmt.Sprintf("--upstream %s", r.Upstream.Name),
+		fmt.Sprintf("--upstream-namespace %s", r.Upstream.Namespace),
+		fmt.Sprintf("--subset-key %s", r.SubsetKey),
+		fmt.Sprintf("--primary %s", r.Primary),
+		fmt.Sprintf("--canary %s", r.Canary),
+		fmt.Sprintf("--header '%s=%s'", r.Header.Name, r.Header.Value),
+		fmt.Sprintf("--weights %s", strings.Join(weights, ",")),
+		fmt.Sprintf("--interval %s", r.Interval),
+		fmt.Sprintf("--min-requests %d", r.MinRequests),
+		fmt.Sprintf("--error-budget %v", r.ErrorBudget),
+		fmt.Sprintf("--envoy-admin http://localhost:%d", envoyAdminPort),
+		fmt.Sprintf("--timeout %s", stepTimeout),
+		fmt.Sprintf("--expect %s", expect),
+	}, " ")
+}
+
+// Step runs the rollout while sending traffic through the gateway, and fails unless it ends as expected, e.g.
+// RolledBack for a canary that fails too many requests.
+func (r Rollout) Step(traffic Traffic, expect Outcome) *workflow.Step {
+	lines := append([]string{buildRolloutCommand + " || exit 1"}, bash.PortForwardLines(
+		bash.GatewayProxy(gatewayHttpPort, gatewayHttpPort),
+		bash.GatewayProxy(envoyAdminPort, envoyAdminPort))...)
+	lines = append(lines,
+		fmt.Sprintf("for i in $(seq 30); do curl -s -o /dev/null localhost:%d/ready && break; sleep 1; done", envoyAdminPort),
+		fmt.Sprintf("while true; do %s; done &", traffic.curl("")),
+		"pids+=($!)",
+		fmt.Sprintf("while true; do %s; done &", traffic.curl(fmt.Sprintf("%s: %s", r.Header.Name, r.Header.Value))),
+		"pids+=($!)",
+		r.command(expect))
+	return bash.Step(lines...)
+}
@@ -0,0 +1,132 @@
+package certs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// Certificates are generated locally, relative to the workflow directory.
+const Dir = "_output/certs"
+
+// The root CA is regenerated when it expires within this many seconds.
+const rootCAMinValidity = 7 * 24 * 60 * 60
+
+func RootCACert() string {
+	return Dir + "/rootCA.crt"
+}
+
+func rootCAKey() string {
+	return Dir + "/rootCA.key"
+}
+
+// UntrustedRootCACert is a root CA that signs none of the certificates, to check that verification against it fails.
+func UntrustedRootCACert() string {
+	return Dir + "/untrustedCA.crt"
+}
+
+func untrustedRootCAKey() string {
+	return Dir + "/untrustedCA.key"
+}
+
+func KeyFile(domain string) string {
+	return fmt.Sprintf("%s/%s.key", Dir, domain)
+}
+
+func CertFile(domain string) string {
+	return fmt.Sprintf("%s/%s.crt", Dir, domain)
+}
+
+func bash(lines ...string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// CreateRootCA generates a self-signed root CA, reusing the one from a previous run unless it is about to expire.
+// Checked-in certificates expire and break the workflows that verify them, so they are generated on each run instead.
+func CreateRootCA() *workflow.Step {
+	return createRootCA(RootCACert(), rootCAKey(), "root CA", "solo.io")
+}
+
+// CreateUntrustedRootCA generates the root CA for UntrustedRootCACert, like CreateRootCA.
+func CreateUntrustedRootCA() *workflow.Step {
+	return createRootCA(UntrustedRootCACert(), untrustedRootCAKey(), "untrusted root CA", "untrusted.solo.io")
+}
+
+func createRootCA(cert, key, description, commonName string) *workflow.Step {
+	return bash(
+		"set -e",
+		fmt.Sprintf("mkdir -p %s", Dir),
+		fmt.Sprintf("if openssl x509 -checkend %d -noout -in %s >/dev/null 2>&1; then echo 'Reusing %s'; exit 0; fi",
+			rootCAMinValidity, cert, description),
+		fmt.Sprintf("openssl genrsa -out %s 4096 2>/dev/null", key),
+		fmt.Sprintf(`openssl req -x509 -new -nodes -key %s -sha256 -days 1024 -subj "/O=Solo.io/CN=%s" -out %s`,
+			key, commonName, cert),
+		fmt.Sprintf("echo 'Generated %s'", description))
+}
+
+// CreateCertificate generates a key and a certificate for the domain, signed by the root CA.
+// The domain is set as the common name and as a subject alternative name.
+func CreateCertificate(domain string) *workflow.Step {
+	return CreateNamedCertificate(domain, domain)
+}
+
+// CreateNamedCertificate is like CreateCertificate, but saves the key and certificate under a name other than the domain,
+// so that more than one certificate can be generated for the same domain.
+func CreateNamedCertificate(name, domain string) *workflow.Step {
+	csr := fmt.Sprintf("%s/%s.csr", Dir, name)
+	ext := fmt.Sprintf("%s/%s.ext", Dir, name)
+	return bash(
+		"set -e",
+		fmt.Sprintf("openssl genrsa -out %s 2048 2>/dev/null", KeyFile(name)),
+		fmt.Sprintf(`openssl req -new -key %s -subj "/CN=%s" -out %s`, KeyFile(name), domain, csr),
+		fmt.Sprintf(`echo "subjectAltName=DNS:%s" > %s`, domain, ext),
+		fmt.Sprintf("openssl x509 -req -in %s -CA %s -CAkey %s -CAcreateserial -days 500 -sha256 -extfile %s -out %s 2>/dev/null",
+			csr, RootCACert(), rootCAKey(), ext, CertFile(name)),
+		fmt.Sprintf("echo 'Generated certificate for %s'", name))
+}
+
+// CreateTlsSecret creates (or replaces) a kubernetes.io/tls secret with the key and certificate generated for the domain,
+// or under that name by CreateNamedCertificate. It renders the secret with --dry-run=client, so it needs kubectl 1.18
+// or later.
+func CreateTlsSecret(namespace, name, domain string) *workflow.Step {
+	return bash(
+		"set -e",
+		fmt.Sprintf("kubectl create secret tls %s -n %s --key %s --cert %s --dry-run=client -o yaml | kubectl apply -f -",
+			name, namespace, KeyFile(domain), CertFile(domain)))
+}
+
+// CreateRootCASecret creates (or replaces) a generic secret with the root CA certificate under ca.crt, for workloads
+// that need to trust the certificates it signs.
+func CreateRootCASecret(namespace, name string) *workflow.Step {
+	return bash(
+		"set -e",
+		fmt.Sprintf("kubectl create secret generic %s -n %s --from-file ca.crt=%s --dry-run=client -o yaml | kubectl apply -f -",
+			name, namespace, RootCACert()))
+}
+
+// CreateMtlsSecret creates (or replaces) a Gloo TLS secret with the key and certificate for the domain, along with
+// the root CA. Gloo uses the root CA to verify the upstream's certificate, so an upstream referencing it uses mutual TLS.
+func CreateMtlsSecret(namespace, name, domain string) *workflow.Step {
+	return CreateMtlsSecretWithRootCA(namespace, name, domain, RootCACert())
+}
+
+// CreateMtlsSecretWithRootCA is like CreateMtlsSecret, with another root CA, e.g. UntrustedRootCACert to check that
+// Gloo rejects an upstream certificate that it didn't sign.
+func CreateMtlsSecretWithRootCA(namespace, name, domain, rootCA string) *workflow.Step {
+	return bash(
+		"set -e",
+		fmt.Sprintf("kubectl delete secret %s -n %s --ignore-not-found", name, namespace),
+		fmt.Sprintf("glooctl create secret tls %s --namespace %s --privatekey %s --certchain %s --rootca %s",
+			name, namespace, KeyFile(domain), CertFile(domain), rootCA))
+}
+
+// DeleteSecret deletes a secret created by CreateTlsSecret or CreateMtlsSecret, if it exists.
+func DeleteSecret(namespace, name string) *workflow.Step {
+	return bash(fmt.Sprintf("kubectl delete secret %s -n %s --ignore-not-found", name, namespace))
+}
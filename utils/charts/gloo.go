@@ -0,0 +1,160 @@
+package charts
+
+// Typed views of the Gloo resources the charts in this repo render, with just the fields they set. The canary
+// controller builds virtual services with them too, and the delegation analyzer reads the part 2 resources.
+
+type ResourceRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type Subset struct {
+	Values map[string]string `json:"values"`
+}
+
+type Destination struct {
+	Upstream ResourceRef `json:"upstream"`
+	Subset   *Subset     `json:"subset,omitempty"`
+}
+
+type WeightedDestination struct {
+	Destination Destination `json:"destination"`
+	Weight      int         `json:"weight"`
+}
+
+type MultiDestination struct {
+	Destinations []WeightedDestination `json:"destinations"`
+}
+
+type RouteAction struct {
+	Single *Destination      `json:"single,omitempty"`
+	Multi  *MultiDestination `json:"multi,omitempty"`
+}
+
+type HeaderMatcher struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Regex       bool   `json:"regex,omitempty"`
+	InvertMatch bool   `json:"invertMatch,omitempty"`
+}
+
+type Matcher struct {
+	Prefix  string          `json:"prefix,omitempty"`
+	Exact   string          `json:"exact,omitempty"`
+	Regex   string          `json:"regex,omitempty"`
+	Headers []HeaderMatcher `json:"headers,omitempty"`
+}
+
+type Shadowing struct {
+	Upstream   ResourceRef `json:"upstream"`
+	Percentage float64     `json:"percentage"`
+}
+
+type RetryPolicy struct {
+	RetryOn       string `json:"retryOn,omitempty"`
+	NumRetries    int    `json:"numRetries,omitempty"`
+	PerTryTimeout string `json:"perTryTimeout,omitempty"`
+}
+
+type HeaderValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type HeaderValueOption struct {
+	Header HeaderValue `json:"header"`
+}
+
+type HeaderManipulation struct {
+	RequestHeadersToAdd     []HeaderValueOption `json:"requestHeadersToAdd,omitempty"`
+	RequestHeadersToRemove  []string            `json:"requestHeadersToRemove,omitempty"`
+	ResponseHeadersToAdd    []HeaderValueOption `json:"responseHeadersToAdd,omitempty"`
+	ResponseHeadersToRemove []string            `json:"responseHeadersToRemove,omitempty"`
+}
+
+type RouteOptions struct {
+	Timeout            string              `json:"timeout,omitempty"`
+	Retries            *RetryPolicy        `json:"retries,omitempty"`
+	HeaderManipulation *HeaderManipulation `json:"headerManipulation,omitempty"`
+	PrefixRewrite      string              `json:"prefixRewrite,omitempty"`
+	Shadowing          *Shadowing          `json:"shadowing,omitempty"`
+}
+
+type DelegateSelector struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	// Defaults to the namespace of the delegating resource, and * selects every namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// A DelegateAction hands a prefix to route tables, either one by ref or all of those a selector matches. The
+// deprecated form sets the name and namespace of the route table directly.
+type DelegateAction struct {
+	Name      string            `json:"name,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Ref       *ResourceRef      `json:"ref,omitempty"`
+	Selector  *DelegateSelector `json:"selector,omitempty"`
+}
+
+type Route struct {
+	Matchers       []Matcher       `json:"matchers"`
+	RouteAction    *RouteAction    `json:"routeAction,omitempty"`
+	DelegateAction *DelegateAction `json:"delegateAction,omitempty"`
+	Options        *RouteOptions   `json:"options,omitempty"`
+}
+
+type RouteTable struct {
+	Metadata Metadata `json:"metadata"`
+	Spec     struct {
+		Routes []Route `json:"routes"`
+		// Route tables selected together are ordered by weight, lowest first.
+		Weight int `json:"weight,omitempty"`
+	} `json:"spec"`
+}
+
+type VirtualHost struct {
+	Domains []string `json:"domains"`
+	Routes  []Route  `json:"routes"`
+}
+
+type VirtualServiceSpec struct {
+	VirtualHost VirtualHost `json:"virtualHost"`
+}
+
+// Unlike the other views, a VirtualService keeps its apiVersion and kind, so it can be applied as-is.
+type VirtualService struct {
+	ApiVersion string             `json:"apiVersion,omitempty"`
+	Kind       string             `json:"kind,omitempty"`
+	Metadata   Metadata           `json:"metadata"`
+	Spec       VirtualServiceSpec `json:"spec"`
+}
+
+// TotalWeight is the sum of the weights of a multi destination route action, which Gloo splits traffic by.
+func (a *RouteAction) TotalWeight() int {
+	if a.Multi == nil {
+		return 0
+	}
+	total := 0
+	for _, destination := range a.Multi.Destinations {
+		total += destination.Weight
+	}
+	return total
+}
+
+type SubsetSelector struct {
+	Keys []string `json:"keys"`
+}
+
+type Upstream struct {
+	Metadata Metadata `json:"metadata"`
+	Spec     struct {
+		Kube *struct {
+			Selector         map[string]string `json:"selector"`
+			ServiceName      string            `json:"serviceName"`
+			ServiceNamespace string            `json:"serviceNamespace"`
+			ServicePort      int               `json:"servicePort"`
+			SubsetSpec       *struct {
+				Selectors []SubsetSelector `json:"selectors"`
+			} `json:"subsetSpec,omitempty"`
+		} `json:"kube,omitempty"`
+	} `json:"spec"`
+}
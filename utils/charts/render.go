@@ -0,0 +1,167 @@
+package charts
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	errors "github.com/rotisserie/eris"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+var (
+	ObjectNotFoundError = func(kind, name string) error {
+		return errors.Errorf("Rendered chart has no %s %s", kind, name)
+	}
+)
+
+// The release a chart is rendered for, as in `helm install NAME CHART --namespace NAMESPACE`.
+type Release struct {
+	Name      string
+	Namespace string
+}
+
+type Metadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// An Object is one document from the rendered templates.
+type Object struct {
+	// The template the object was rendered from, e.g. gloo-app/templates/routetable.yaml, or the file it was loaded
+	// from.
+	Template string
+	Kind     string
+	Metadata Metadata
+	Manifest string
+}
+
+// Decode unmarshals the object's manifest into one of the typed views, e.g. a RouteTable.
+func (o *Object) Decode(into interface{}) error {
+	if err := yaml.Unmarshal([]byte(o.Manifest), into); err != nil {
+		return errors.Wrapf(err, "decoding %s %s from %s", o.Kind, o.Metadata.Name, o.Template)
+	}
+	return nil
+}
+
+type Manifests struct {
+	Objects []Object
+}
+
+// Find returns the object with the kind and name, or nil if the chart didn't render one.
+func (m *Manifests) Find(kind, name string) *Object {
+	for i := range m.Objects {
+		if m.Objects[i].Kind == kind && m.Objects[i].Metadata.Name == name {
+			return &m.Objects[i]
+		}
+	}
+	return nil
+}
+
+// OfKind returns every object of the kind, in the order they were rendered.
+func (m *Manifests) OfKind(kind string) []Object {
+	var objects []Object
+	for _, object := range m.Objects {
+		if object.Kind == kind {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// Decode finds the object with the kind and name, and unmarshals it into one of the typed views.
+func (m *Manifests) Decode(kind, name string, into interface{}) error {
+	object := m.Find(kind, name)
+	if object == nil {
+		return ObjectNotFoundError(kind, name)
+	}
+	return object.Decode(into)
+}
+
+// Render renders a chart directory the way `helm template` would, with the values files merged in order, so that
+// charts can be tested without a cluster. Values are checked against the chart's values.schema.json, if it has one.
+func Render(chartDir string, release Release, valuesFiles ...string) (*Manifests, error) {
+	chart, err := loader.Load(chartDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading chart %s", chartDir)
+	}
+	options := values.Options{ValueFiles: valuesFiles}
+	vals, err := options.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading values files %v", valuesFiles)
+	}
+	renderValues, err := chartutil.ToRenderValues(chart, vals, chartutil.ReleaseOptions{
+		Name:      release.Name,
+		Namespace: release.Namespace,
+		IsInstall: true,
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rendering values for chart %s", chartDir)
+	}
+	rendered, err := engine.Render(chart, renderValues)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rendering chart %s", chartDir)
+	}
+
+	// Templates are sorted so the objects are in a stable order
+	var templates []string
+	for template := range rendered {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	manifests := &Manifests{}
+	for _, template := range templates {
+		if filepath.Ext(template) != ".yaml" {
+			continue
+		}
+		if err := manifests.add(template, rendered[template]); err != nil {
+			return nil, err
+		}
+	}
+	return manifests, nil
+}
+
+// Load reads the objects from manifest files, like the ones applied in each part, so they can be checked alongside
+// rendered charts.
+func Load(files ...string) (*Manifests, error) {
+	manifests := &Manifests{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", file)
+		}
+		if err := manifests.add(file, string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return manifests, nil
+}
+
+func (m *Manifests) add(source, content string) error {
+	for _, doc := range strings.Split(content, "\n---") {
+		if strings.TrimSpace(doc) == "" || strings.TrimSpace(doc) == "---" {
+			continue
+		}
+		var header struct {
+			Kind     string   `json:"kind"`
+			Metadata Metadata `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &header); err != nil {
+			return errors.Wrapf(err, "parsing %s", source)
+		}
+		m.Objects = append(m.Objects, Object{
+			Template: source,
+			Kind:     header.Kind,
+			Metadata: header.Metadata,
+			Manifest: doc,
+		})
+	}
+	return nil
+}
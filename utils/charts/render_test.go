@@ -0,0 +1,291 @@
+package charts_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+func TestCharts(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Chart Rendering Suite")
+}
+
+const part3 = "../../two-phased-canary/part3"
+
+// What a stage of the part 3 canary workflow should route to.
+type stage struct {
+	deployments []string
+	primary     string
+	// Empty when there's no canary route
+	canary        string
+	canaryWeight  int
+	canaryHeaders map[string]string
+}
+
+var _ = Describe("gloo-app chart", func() {
+
+	render := func(release, valuesFile string) *charts.Manifests {
+		manifests, err := charts.Render(part3+"/gloo-app", charts.Release{Name: release, Namespace: release}, part3+"/"+valuesFile)
+		Expect(err).NotTo(HaveOccurred())
+		return manifests
+	}
+
+	expectDestination := func(destination charts.Destination, release, version string) {
+		Expect(destination.Upstream).To(Equal(charts.ResourceRef{Name: release, Namespace: release}))
+		Expect(destination.Subset).NotTo(BeNil())
+		Expect(destination.Subset.Values).To(Equal(map[string]string{"version": version}))
+	}
+
+	expectStage := func(release, valuesFile string, expected stage) {
+		manifests := render(release, valuesFile)
+
+		var deployments []string
+		for _, deployment := range manifests.OfKind("Deployment") {
+			Expect(deployment.Metadata.Namespace).To(Equal(release))
+			deployments = append(deployments, deployment.Metadata.Name)
+		}
+		var expectedDeployments []string
+		for _, version := range expected.deployments {
+			expectedDeployments = append(expectedDeployments, release+"-"+version)
+		}
+		Expect(deployments).To(ConsistOf(expectedDeployments))
+
+		var upstream charts.Upstream
+		Expect(manifests.Decode("Upstream", release, &upstream)).To(Succeed())
+		Expect(upstream.Metadata.Namespace).To(Equal(release))
+		Expect(upstream.Spec.Kube).NotTo(BeNil())
+		Expect(upstream.Spec.Kube.Selector).To(Equal(map[string]string{"app": release}))
+		Expect(upstream.Spec.Kube.ServiceName).To(Equal(release))
+		Expect(upstream.Spec.Kube.ServiceNamespace).To(Equal(release))
+		Expect(upstream.Spec.Kube.ServicePort).To(Equal(8080))
+		Expect(upstream.Spec.Kube.SubsetSpec).NotTo(BeNil())
+		Expect(upstream.Spec.Kube.SubsetSpec.Selectors).To(Equal([]charts.SubsetSelector{{Keys: []string{"version"}}}))
+
+		var routeTable charts.RouteTable
+		Expect(manifests.Decode("RouteTable", release+"-routes", &routeTable)).To(Succeed())
+		Expect(routeTable.Metadata.Namespace).To(Equal(release))
+		Expect(routeTable.Metadata.Labels).To(Equal(map[string]string{"apiGroup": "example"}))
+		routes := routeTable.Spec.Routes
+
+		if expected.canary == "" {
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Matchers).To(Equal([]charts.Matcher{{Prefix: "/" + release}}))
+			Expect(routes[0].RouteAction.Multi).To(BeNil())
+			Expect(routes[0].RouteAction.Single).NotTo(BeNil())
+			expectDestination(*routes[0].RouteAction.Single, release, expected.primary)
+			return
+		}
+
+		Expect(routes).To(HaveLen(2))
+		// The canary route comes first, so that requests with the headers don't match the primary route
+		canaryRoute, primaryRoute := routes[0], routes[1]
+		Expect(canaryRoute.Matchers).To(HaveLen(1))
+		Expect(canaryRoute.Matchers[0].Prefix).To(Equal("/" + release))
+		var headers []charts.HeaderMatcher
+		for name, value := range expected.canaryHeaders {
+			headers = append(headers, charts.HeaderMatcher{Name: name, Value: value})
+		}
+		Expect(canaryRoute.Matchers[0].Headers).To(ConsistOf(headers))
+		Expect(canaryRoute.RouteAction.Single).NotTo(BeNil())
+		expectDestination(*canaryRoute.RouteAction.Single, release, expected.canary)
+
+		Expect(primaryRoute.Matchers).To(Equal([]charts.Matcher{{Prefix: "/" + release}}))
+		Expect(primaryRoute.RouteAction.Single).To(BeNil())
+		Expect(primaryRoute.RouteAction.Multi).NotTo(BeNil())
+		Expect(primaryRoute.RouteAction.TotalWeight()).To(Equal(100))
+		destinations := primaryRoute.RouteAction.Multi.Destinations
+		Expect(destinations).To(HaveLen(2))
+		expectDestination(destinations[0].Destination, release, expected.primary)
+		Expect(destinations[0].Weight).To(Equal(100 - expected.canaryWeight))
+		expectDestination(destinations[1].Destination, release, expected.canary)
+		Expect(destinations[1].Weight).To(Equal(expected.canaryWeight))
+	}
+
+	canaryHeaders := map[string]string{"stage": "canary"}
+
+	stages := []table.TableEntry{
+		table.Entry("values-1.yaml: v1 only", "values-1.yaml", stage{
+			deployments: []string{"v1"},
+			primary:     "v1",
+		}),
+		table.Entry("values-2.yaml: v2 deployed without routes", "values-2.yaml", stage{
+			deployments: []string{"v1", "v2"},
+			primary:     "v1",
+		}),
+		table.Entry("values-3.yaml: canary headers route to v2, without a weight", "values-3.yaml", stage{
+			deployments:   []string{"v1", "v2"},
+			primary:       "v1",
+			canary:        "v2",
+			canaryWeight:  0,
+			canaryHeaders: canaryHeaders,
+		}),
+		table.Entry("values-4.yaml: half of the traffic shifted to v2", "values-4.yaml", stage{
+			deployments:   []string{"v1", "v2"},
+			primary:       "v1",
+			canary:        "v2",
+			canaryWeight:  50,
+			canaryHeaders: canaryHeaders,
+		}),
+		table.Entry("values-5.yaml: all of the traffic shifted to v2", "values-5.yaml", stage{
+			deployments:   []string{"v1", "v2"},
+			primary:       "v1",
+			canary:        "v2",
+			canaryWeight:  100,
+			canaryHeaders: canaryHeaders,
+		}),
+		table.Entry("values-6.yaml: v2 only", "values-6.yaml", stage{
+			deployments: []string{"v2"},
+			primary:     "v2",
+		}),
+	}
+
+	Context("for echo", func() {
+		table.DescribeTable("renders each stage of the workflow",
+			func(valuesFile string, expected stage) {
+				expectStage("echo", valuesFile, expected)
+			},
+			stages...,
+		)
+	})
+
+	Context("for foxtrot", func() {
+		table.DescribeTable("renders each stage of the workflow",
+			func(valuesFile string, expected stage) {
+				expectStage("foxtrot", valuesFile, expected)
+			},
+			stages...,
+		)
+	})
+
+	It("uses the chart's default values without a values file", func() {
+		manifests, err := charts.Render(part3+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifests.OfKind("Deployment")).To(BeEmpty())
+		var routeTable charts.RouteTable
+		Expect(manifests.Decode("RouteTable", "echo-routes", &routeTable)).To(Succeed())
+		Expect(routeTable.Spec.Routes).To(HaveLen(1))
+	})
+
+	It("merges values files in order, like helm", func() {
+		manifests, err := charts.Render(part3+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"},
+			part3+"/values-4.yaml", part3+"/values-6.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		var routeTable charts.RouteTable
+		Expect(manifests.Decode("RouteTable", "echo-routes", &routeTable)).To(Succeed())
+		// values-6.yaml doesn't unset the canary from values-4.yaml, so it is still rendered
+		Expect(routeTable.Spec.Routes).To(HaveLen(2))
+		Expect(routeTable.Spec.Routes[1].RouteAction.Multi.Destinations[0].Destination.Subset.Values["version"]).To(Equal("v2"))
+	})
+
+	It("reports objects that weren't rendered", func() {
+		var upstream charts.Upstream
+		Expect(render("echo", "values-1.yaml").Decode("Upstream", "foxtrot", &upstream)).To(MatchError(ContainSubstring("has no Upstream foxtrot")))
+	})
+})
+
+var _ = Describe("gloo-app chart with route options", func() {
+
+	render := func(valuesFile string) *charts.Manifests {
+		manifests, err := charts.Render(part4+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"}, part4+"/"+valuesFile)
+		Expect(err).NotTo(HaveOccurred())
+		return manifests
+	}
+
+	routes := func(manifests *charts.Manifests) []charts.Route {
+		var routeTable charts.RouteTable
+		Expect(manifests.Decode("RouteTable", "echo-routes", &routeTable)).To(Succeed())
+		return routeTable.Spec.Routes
+	}
+
+	It("doesn't shadow without the option", func() {
+		manifests := render("values-1.yaml")
+		Expect(manifests.OfKind("Upstream")).To(HaveLen(1))
+		for _, route := range routes(manifests) {
+			Expect(route.Options).To(BeNil())
+		}
+	})
+
+	It("shadows all of the primary traffic by default", func() {
+		manifests := render("values-2.yaml")
+		var upstream charts.Upstream
+		Expect(manifests.Decode("Upstream", "shadow-v2", &upstream)).To(Succeed())
+		Expect(upstream.Metadata.Namespace).To(Equal("echo"))
+		Expect(upstream.Spec.Kube.Selector).To(Equal(map[string]string{"app": "echo", "version": "v2"}))
+		Expect(upstream.Spec.Kube.ServiceName).To(Equal("echo"))
+		Expect(upstream.Spec.Kube.ServiceNamespace).To(Equal("echo"))
+
+		Expect(routes(manifests)).To(HaveLen(2))
+		for _, route := range routes(manifests) {
+			Expect(route.Options.Shadowing).To(Equal(&charts.Shadowing{
+				Upstream:   charts.ResourceRef{Name: "shadow-v2", Namespace: "echo"},
+				Percentage: 100,
+			}))
+		}
+	})
+
+	It("shadows a percentage of the primary traffic", func() {
+		for _, route := range routes(render("values-3.yaml")) {
+			Expect(route.Options.Shadowing.Percentage).To(Equal(50.0))
+		}
+	})
+
+	It("shadows none of the primary traffic when the percentage is 0", func() {
+		manifests, err := charts.Render(part4+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"},
+			part4+"/values-3.yaml", "testdata/values-part4-no-shadowing.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		for _, route := range routes(manifests) {
+			Expect(route.Options.Shadowing.Percentage).To(BeZero())
+		}
+	})
+
+	It("sets the other route options on both the canary and primary routes", func() {
+		expected := &charts.RouteOptions{
+			Timeout: "1s",
+			Retries: &charts.RetryPolicy{RetryOn: "5xx", NumRetries: 2},
+			HeaderManipulation: &charts.HeaderManipulation{
+				RequestHeadersToAdd:    []charts.HeaderValueOption{{Header: charts.HeaderValue{Key: "x-gloo-app", Value: "echo"}}},
+				RequestHeadersToRemove: []string{"x-internal"},
+				ResponseHeadersToAdd:   []charts.HeaderValueOption{{Header: charts.HeaderValue{Key: "x-served-by", Value: "gloo-app"}}},
+			},
+			PrefixRewrite: "/api",
+		}
+		routes := routes(render("values-4.yaml"))
+		Expect(routes).To(HaveLen(4))
+		for _, route := range routes {
+			Expect(route.Options).To(Equal(expected))
+		}
+	})
+
+	It("only sets the options that have values", func() {
+		manifests, err := charts.Render(part4+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"},
+			part4+"/values-1.yaml", "testdata/values-part4-timeout.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		for _, route := range routes(manifests) {
+			Expect(route.Options).To(Equal(&charts.RouteOptions{Timeout: "2.5s"}))
+		}
+	})
+
+	It("only shadows the primary route, not the canary route", func() {
+		manifests, err := charts.Render(part4+"/gloo-app", charts.Release{Name: "foxtrot", Namespace: "foxtrot"},
+			part4+"/values-3.yaml", "testdata/values-part4-canary.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifests.Find("Upstream", "shadow-v2").Metadata.Namespace).To(Equal("foxtrot"))
+		var routeTable charts.RouteTable
+		Expect(manifests.Decode("RouteTable", "foxtrot-routes", &routeTable)).To(Succeed())
+		// A canary and primary route for each of the two prefixes
+		Expect(routeTable.Spec.Routes).To(HaveLen(4))
+		for i, route := range routeTable.Spec.Routes {
+			if i%2 == 0 {
+				Expect(route.Matchers[0].Headers).NotTo(BeEmpty())
+				Expect(route.Options).To(BeNil())
+			} else {
+				Expect(route.RouteAction.Multi).NotTo(BeNil())
+				Expect(route.Options.Shadowing.Upstream).To(Equal(charts.ResourceRef{Name: "shadow-v2", Namespace: "foxtrot"}))
+			}
+		}
+	})
+})
@@ -0,0 +1,116 @@
+package charts
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	errors "github.com/rotisserie/eris"
+	"github.com/xeipuuv/gojsonschema"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+var (
+	NoSchemaError = func(chartDir string) error {
+		return errors.Errorf("Chart %s has no values.schema.json", chartDir)
+	}
+)
+
+// Where the gloo-app chart keeps the primary and canary versions: part 3 uses routes.primary and routes.canary,
+// and part 4 moved them under routing. Part 4 can also shadow traffic to a canary version.
+var canaryVersionPaths = []struct {
+	primary string
+	canary  string
+}{
+	{primary: "routes.primary.version", canary: "routes.canary.version"},
+	{primary: "routing.version", canary: "routing.canary.version"},
+	{primary: "routing.version", canary: "routing.options.shadowing.version"},
+}
+
+// A ValuesProblem is something wrong with a values file, at a field like routes.canary.
+type ValuesProblem struct {
+	File    string
+	Field   string
+	Message string
+}
+
+func (p ValuesProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", filepath.Base(p.File), p.Field, p.Message)
+}
+
+// ValidateValues checks a values file, merged with the chart's defaults like helm does, against the chart's
+// values.schema.json. It also catches what the schema can't express, like a canary version that's the same as the
+// primary. Helm checks the schema too, but only reports the problems on install, and not all of them.
+func ValidateValues(chartDir, valuesFile string) ([]ValuesProblem, error) {
+	chart, err := loader.Load(chartDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading chart %s", chartDir)
+	}
+	if chart.Schema == nil {
+		return nil, NoSchemaError(chartDir)
+	}
+	values, err := chartutil.ReadValuesFile(valuesFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading values file %s", valuesFile)
+	}
+	merged, err := chartutil.CoalesceValues(chart, values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "merging values file %s with the chart's defaults", valuesFile)
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(chart.Schema), gojsonschema.NewGoLoader(merged.AsMap()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "validating values file %s", valuesFile)
+	}
+	var problems []ValuesProblem
+	for _, schemaError := range result.Errors() {
+		problems = append(problems, ValuesProblem{
+			File:    valuesFile,
+			Field:   strings.TrimPrefix(schemaError.Context().String(), gojsonschema.STRING_CONTEXT_ROOT+"."),
+			Message: describe(schemaError),
+		})
+	}
+
+	for _, paths := range canaryVersionPaths {
+		primary, err := merged.PathValue(paths.primary)
+		if err != nil {
+			continue
+		}
+		canary, err := merged.PathValue(paths.canary)
+		if err != nil {
+			continue
+		}
+		if primary == canary {
+			problems = append(problems, ValuesProblem{
+				File:    valuesFile,
+				Field:   paths.canary,
+				Message: fmt.Sprintf("Canary version %v is the same as the primary version", canary),
+			})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Field < problems[j].Field
+	})
+	return problems, nil
+}
+
+// The schema library's descriptions start with the field's name, which leaves out map keys like the version, and
+// format limits as fractions, like 100/1. The field is reported separately, so it is dropped from the message.
+func describe(schemaError gojsonschema.ResultError) string {
+	message := strings.TrimPrefix(schemaError.Description(), schemaError.Field()+" ")
+	for _, detail := range schemaError.Details() {
+		if rat, ok := detail.(*big.Rat); ok {
+			message = strings.Replace(message, rat.String(), rat.RatString(), -1)
+		}
+	}
+	runes := []rune(message)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+	return string(runes)
+}
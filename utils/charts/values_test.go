@@ -0,0 +1,71 @@
+package charts_test
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+const part4 = "../../two-phased-canary/part4"
+
+var _ = Describe("gloo-app values", func() {
+
+	problems := func(chartDir, valuesFile string) []string {
+		problems, err := charts.ValidateValues(chartDir, valuesFile)
+		Expect(err).NotTo(HaveOccurred())
+		var descriptions []string
+		for _, problem := range problems {
+			descriptions = append(descriptions, problem.String())
+		}
+		return descriptions
+	}
+
+	for _, part := range []string{part3, part4} {
+		part := part
+		It("accepts every values file in "+filepath.Base(part), func() {
+			valuesFiles, err := filepath.Glob(part + "/values-*.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(valuesFiles).NotTo(BeEmpty())
+			for _, valuesFile := range valuesFiles {
+				Expect(problems(part+"/gloo-app", valuesFile)).To(BeEmpty(), valuesFile)
+			}
+		})
+	}
+
+	It("catches misspelled keys, which would otherwise leave the canary without a weight", func() {
+		Expect(problems(part3+"/gloo-app", "testdata/values-wieght.yaml")).To(ConsistOf(
+			"values-wieght.yaml: routes.canary: Additional property wieght is not allowed",
+		))
+	})
+
+	It("catches weights that aren't percentages", func() {
+		Expect(problems(part3+"/gloo-app", "testdata/values-weight-too-high.yaml")).To(ConsistOf(
+			"values-weight-too-high.yaml: routes.canary.weight: Must be less than or equal to 100",
+		))
+	})
+
+	It("catches a canary version that's the same as the primary", func() {
+		Expect(problems(part3+"/gloo-app", "testdata/values-canary-is-primary.yaml")).To(ConsistOf(
+			"values-canary-is-primary.yaml: routes.canary.version: Canary version v1 is the same as the primary version",
+		))
+	})
+
+	It("checks the part 4 layout", func() {
+		Expect(problems(part4+"/gloo-app", "testdata/values-part4-problems.yaml")).To(ConsistOf(
+			`values-part4-problems.yaml: deployment.v1.imagePullPolicy: Must be one of the following: "Always", "IfNotPresent", "Never"`,
+			"values-part4-problems.yaml: routing.canary.version: Canary version v1 is the same as the primary version",
+			"values-part4-problems.yaml: routing.canary.weight: Must be greater than or equal to 0",
+			"values-part4-problems.yaml: routing.options.shadowing.percentage: Must be less than or equal to 100",
+			`values-part4-problems.yaml: routing.options.timeout: Does not match pattern '^[0-9]+(\.[0-9]+)?s$'`,
+			"values-part4-problems.yaml: routing.options.shadowing.version: Canary version v1 is the same as the primary version",
+			"values-part4-problems.yaml: routing.routes.0: Additional property prefixRewrite is not allowed",
+		))
+	})
+
+	It("is enforced by helm when rendering", func() {
+		_, err := charts.Render(part3+"/gloo-app", charts.Release{Name: "echo", Namespace: "echo"}, "testdata/values-wieght.yaml")
+		Expect(err).To(MatchError(ContainSubstring("Additional property wieght is not allowed")))
+	})
+})
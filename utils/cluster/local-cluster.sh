@@ -0,0 +1,262 @@
+#!/usr/bin/env bash
+#
+# Manages a disposable local cluster for running the workflows.
+#
+#   local-cluster.sh ensure              cache the charts of the workflow in the current directory, create the cluster
+#                                        (loading images) if it doesn't exist, build and load the images built from this
+#                                        repo, and switch to its context
+#   local-cluster.sh charts              cache the charts of the workflow in the current directory
+#   local-cluster.sh images              list the images the workflows pull, from their manifests and charts
+#   local-cluster.sh save [IMAGE...]     cache every workflow's charts and wasm modules, and save the images (by default,
+#                                        the ones listed by images) into the image archive, i.e. on a machine with
+#                                        registry access
+#   local-cluster.sh build IMAGE         build an image from this repo and load it into the current context's kind or k3d
+#                                        cluster, if LOCAL_CLUSTER isn't set (otherwise ensure already did)
+#   local-cluster.sh load                load the image archive into the cluster
+#   local-cluster.sh delete              delete the cluster
+#
+# Configured with:
+#   LOCAL_CLUSTER        kind or k3d. When unset, ensure only caches charts, and the current kube context is used.
+#   LOCAL_CLUSTER_NAME   name of the cluster, defaults to gloo-ref-arch
+#   LOCAL_IMAGE_ARCHIVE  tarball in `docker save` format, loaded into the cluster when it is created
+#
+# Workflows install charts from _output/charts in their own directory, which is filled from the cache in the repo's
+# _output/charts, downloading the chart into it if it isn't there yet. Wasm modules, which Gloo pulls from a registry
+# rather than the cluster's images, are kept in the repo's _output/wasm by the wasm.sh of the workflows that use them.
+# After a save, the workflows need no network access, as long as LOCAL_IMAGE_ARCHIVE is set.
+
+set -e
+
+provider="${LOCAL_CLUSTER:-}"
+name="${LOCAL_CLUSTER_NAME:-gloo-ref-arch}"
+archive="${LOCAL_IMAGE_ARCHIVE:-}"
+
+root="$(git rev-parse --show-toplevel)"
+chart_cache="_output/charts"
+
+# The images built from this repo rather than pulled, with the make target that builds them. Manifests use them with
+# imagePullPolicy IfNotPresent, so that the images loaded into the cluster are used.
+dev_images=(
+  "quay.io/solo-io/spelunker:dev docker-build-spelunker"
+  "quay.io/solo-io/access-log-receiver:dev docker-build-access-log-receiver"
+  "quay.io/solo-io/mock-oidc-provider:dev docker-build-mock-oidc-provider"
+  "quay.io/solo-io/request-recorder:dev docker-build-request-recorder"
+)
+
+exists() {
+  case "$provider" in
+    kind) kind get clusters 2>/dev/null | grep -qx "$name" ;;
+    k3d) k3d cluster get "$name" >/dev/null 2>&1 ;;
+  esac
+}
+
+create() {
+  echo "Creating $provider cluster $name"
+  case "$provider" in
+    kind) kind create cluster --name "$name" --wait 120s ;;
+    k3d) k3d cluster create "$name" --wait ;;
+  esac
+}
+
+use_context() {
+  kubectl config use-context "$provider-$name"
+}
+
+load() {
+  if [ -z "$archive" ]; then
+    echo "LOCAL_IMAGE_ARCHIVE not set, images will be pulled from their registries"
+    return
+  fi
+  echo "Loading images from $archive into $provider cluster $name"
+  case "$provider" in
+    kind) kind load image-archive "$archive" --name "$name" ;;
+    k3d) k3d image import "$archive" --cluster "$name" ;;
+  esac
+}
+
+# The base images of the images built from this repo.
+base_images() {
+  find "$root" -name Dockerfile -not -path "*/_output/*" -exec sed -n 's/^FROM *\([^ ]*\).*/\1/p' {} \; | sort -u
+}
+
+# Builds one of the dev_images.
+build_image() {
+  for entry in "${dev_images[@]}"; do
+    read -r image target <<< "$entry"
+    if [ "$image" == "$1" ]; then
+      echo "Building $image"
+      make -s -C "$root" "$target" VERSION=dev
+      return
+    fi
+  done
+  echo "$1 isn't built from this repo"
+  exit 1
+}
+
+# Loads an image from the local docker daemon into a kind or k3d cluster.
+load_image() {
+  echo "Loading $1 into $2 cluster $3"
+  case "$2" in
+    kind) kind load docker-image "$1" --name "$3" ;;
+    k3d) k3d image import "$1" --cluster "$3" ;;
+  esac
+}
+
+build_dev_images() {
+  if [ -n "$archive" ]; then
+    for image in $(base_images); do
+      docker image inspect "$image" >/dev/null 2>&1 || { echo "Loading base images from $archive"; docker load -i "$archive"; break; }
+    done
+  fi
+  for entry in "${dev_images[@]}"; do
+    read -r image _ <<< "$entry"
+    build_image "$image"
+    load_image "$image" "$provider" "$name"
+  done
+}
+
+# Builds a dev image and loads it into the cluster of the current context, for workflows that deploy it when
+# LOCAL_CLUSTER isn't set. Other clusters have to be able to pull it, e.g. from a registry it was pushed to.
+build() {
+  build_image "$1"
+  context="$(kubectl config current-context)"
+  case "$context" in
+    kind-*) load_image "$1" kind "${context#kind-}" ;;
+    k3d-*) load_image "$1" k3d "${context#k3d-}" ;;
+    *) echo "Current context $context isn't a kind or k3d cluster, so it has to pull $1" ;;
+  esac
+}
+
+delete() {
+  echo "Deleting $provider cluster $name"
+  case "$provider" in
+    kind) kind delete cluster --name "$name" ;;
+    k3d) k3d cluster delete "$name" ;;
+  esac
+}
+
+# Prints the chart, and the values files it is installed with, for each helm install in a workflow.yaml. Charts are
+# relative to the chart cache, i.e. the URL they are downloaded from without https://.
+chart_installs() {
+  awk -v prefix="$chart_cache/" '
+    function flush() { if (chart != "") print chart values; chart = ""; values = ""; in_values = 0 }
+    /^[a-z]/ || /^- / { flush() }
+    /^    releaseUri: / { if (index($2, prefix) == 1) chart = substr($2, length(prefix) + 1); next }
+    /^    valuesFiles:/ { in_values = 1; next }
+    in_values && /^    - / { values = values " " $2; next }
+    /^    [a-zA-Z]/ { in_values = 0 }
+    END { flush() }
+  ' "$1"
+}
+
+# Downloads a chart into the repo's chart cache, unless it is already there.
+cache_chart() {
+  local cached="$root/$chart_cache/$1"
+  [ -f "$cached" ] && return
+  echo "Downloading chart https://$1"
+  mkdir -p "$(dirname "$cached")"
+  curl -fsSL -o "$cached.tmp" "https://$1" || { echo "Chart $1 isn't in $root/$chart_cache and couldn't be downloaded"; exit 1; }
+  mv "$cached.tmp" "$cached"
+}
+
+charts() {
+  [ -f workflow.yaml ] || return 0
+  chart_installs workflow.yaml | while read -r chart _; do
+    cache_chart "$chart"
+    mkdir -p "$(dirname "$chart_cache/$chart")"
+    cp "$root/$chart_cache/$chart" "$chart_cache/$chart"
+  done
+}
+
+workflows() {
+  find "$root" -name workflow.yaml -not -path "*/_output/*"
+}
+
+# Lists the images the workflows pull. Wasm modules on webassemblyhub.io aren't pulled by the cluster, so save caches
+# them with wasm.sh instead.
+images() {
+  {
+    grep -rhoE '^[[:space:]]*-?[[:space:]]*image:[[:space:]]*"?[^"[:space:]{]+' --include='*.yaml' --include='*.tmpl' \
+      --exclude-dir=_output --exclude-dir=testdata "$root" | sed -E 's/.*image:[[:space:]]*"?//'
+    for workflow in $(workflows); do
+      dir="$(dirname "$workflow")"
+      chart_installs "$workflow" | while read -r chart values; do
+        args=()
+        for file in $values; do args+=(-f "$dir/$file"); done
+        # Enterprise charts refuse to render without a license key, which doesn't change the images
+        helm template gloo "$root/$chart_cache/$chart" "${args[@]}" --set license_key=unused 2>/dev/null |
+          sed -n -E 's/^[[:space:]]*-?[[:space:]]*image:[[:space:]]*"?([^"[:space:]]+)"?.*/\1/p'
+      done
+    done
+    base_images
+  } | grep -v -e ':dev$' -e '^webassemblyhub.io/' | sort -u
+}
+
+save() {
+  [ -n "$archive" ] || { echo "LOCAL_IMAGE_ARCHIVE must be set"; exit 1; }
+  for workflow in $(workflows); do
+    chart_installs "$workflow" | while read -r chart _; do cache_chart "$chart"; done
+  done
+  for script in $(find "$root" -name wasm.sh -not -path "*/_output/*"); do
+    (cd "$(dirname "$script")" && ./wasm.sh ensure)
+  done
+  local list=("$@")
+  [ ${#list[@]} -gt 0 ] || list=($(images))
+  for image in "${list[@]}"; do
+    docker image inspect "$image" >/dev/null 2>&1 || docker pull "$image"
+  done
+  echo "Saving ${#list[@]} images to $archive"
+  docker save -o "$archive" "${list[@]}"
+}
+
+command="$1"
+shift || true
+
+case "$command" in
+  charts) charts; exit 0 ;;
+  images) images; exit 0 ;;
+  save) save "$@"; exit 0 ;;
+  build)
+    # ensure already built and loaded it into the local cluster
+    [ -z "$provider" ] && build "$1"
+    exit 0
+    ;;
+esac
+
+if [ "$command" == "ensure" ]; then
+  charts
+fi
+
+case "$provider" in
+  "")
+    echo "LOCAL_CLUSTER not set, using the current kube context"
+    exit 0
+    ;;
+  kind|k3d) ;;
+  *)
+    echo "Unsupported LOCAL_CLUSTER '$provider', expected kind or k3d"
+    exit 1
+    ;;
+esac
+
+case "$command" in
+  ensure)
+    if exists; then
+      use_context
+    else
+      create
+      load
+    fi
+    build_dev_images
+    ;;
+  load) load ;;
+  delete)
+    if exists; then
+      delete
+    fi
+    ;;
+  *)
+    echo "Usage: $0 ensure|charts|images|save [IMAGE...]|build IMAGE|load|delete"
+    exit 1
+    ;;
+esac
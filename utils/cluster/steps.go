@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// Workflows run from their own directory, so the script is located relative to the repo root.
+const localClusterScript = `"$(git rev-parse --show-toplevel)/utils/cluster/local-cluster.sh"`
+
+func localCluster(command string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("bash %s %s", localClusterScript, command),
+		},
+	}
+}
+
+// Charts are installed from the workflow's _output directory, which EnsureLocalCluster fills from a cache in the
+// repo root, so that workflows can run without network access.
+const chartDir = "_output/charts"
+
+// Chart is where a workflow installs the chart published at url from, once EnsureLocalCluster has run.
+func Chart(url string) string {
+	return chartDir + "/" + strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+}
+
+// EnsureLocalCluster caches the workflow's charts, and creates a kind or k3d cluster (per LOCAL_CLUSTER) if it
+// doesn't exist yet, loading images from LOCAL_IMAGE_ARCHIVE. It then builds and loads the images built from this
+// repo, and switches to the cluster's context. It only caches charts if LOCAL_CLUSTER isn't set.
+func EnsureLocalCluster() *workflow.Step {
+	return localCluster("ensure")
+}
+
+func DeleteLocalCluster() *workflow.Step {
+	return localCluster("delete")
+}
+
+// BuildImage builds an image from this repo, e.g. quay.io/solo-io/mock-oidc-provider:dev, and loads it into the
+// current context's cluster if it is a kind or k3d cluster. Local clusters created by EnsureLocalCluster already have it.
+func BuildImage(image string) *workflow.Step {
+	return localCluster("build " + image)
+}
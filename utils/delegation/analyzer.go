@@ -0,0 +1,443 @@
+package delegation
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	errors "github.com/rotisserie/eris"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+const (
+	VirtualServiceKind = "VirtualService"
+	RouteTableKind     = "RouteTable"
+	UpstreamKind       = "Upstream"
+
+	allNamespaces = "*"
+	defaultPrefix = "/"
+)
+
+var (
+	NoVirtualServiceError = func() error {
+		return errors.Errorf("None of the files define a VirtualService")
+	}
+)
+
+type Kind string
+
+const (
+	OverlappingPrefixes Kind = "overlapping prefixes"
+	ShadowedMatcher     Kind = "shadowed matcher"
+	OrderingProblem     Kind = "ordering problem"
+	InvalidDestination  Kind = "invalid destination"
+	InvalidDelegation   Kind = "invalid delegation"
+	UnusedRouteTable    Kind = "unused route table"
+	DuplicateDefinition Kind = "duplicate definition"
+)
+
+// A Problem is something wrong with the routes in a file, which Gloo would reject, or which would send requests
+// somewhere other than the team that owns the file meant to.
+type Problem struct {
+	File string
+	// The resource the problem is in, e.g. RouteTable echo.echo-routes.
+	Resource string
+	// The index of the route in the resource, or -1 if the problem is with the resource as a whole.
+	Route   int
+	Kind    Kind
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.Resource
+	if p.Route >= 0 {
+		location += fmt.Sprintf(" route %d", p.Route)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", filepath.Base(p.File), location, p.Kind, p.Message)
+}
+
+// A virtual service or route table, and the file it was defined in.
+type resource struct {
+	file   string
+	kind   string
+	ref    charts.ResourceRef
+	labels map[string]string
+	routes []charts.Route
+	weight int
+}
+
+func (r *resource) String() string {
+	return fmt.Sprintf("%s %s.%s", r.kind, r.ref.Namespace, r.ref.Name)
+}
+
+// A route as Envoy ends up with it, once delegation has been resolved, and where it was defined.
+type flatRoute struct {
+	owner *resource
+	index int
+	route charts.Route
+	// The other route tables selected along with the owner that have the same weight, so Gloo doesn't define
+	// whether they come before or after it.
+	tiedWith map[*resource]bool
+}
+
+func (r flatRoute) describe() string {
+	return fmt.Sprintf("route %d of %s (%s)", r.index, r.owner, filepath.Base(r.owner.file))
+}
+
+type analyzer struct {
+	virtualServices []*resource
+	routeTables     []*resource
+	upstreams       map[charts.ResourceRef]*charts.Upstream
+	used            map[*resource]bool
+	problems        []Problem
+}
+
+func (a *analyzer) report(owner *resource, route int, kind Kind, format string, args ...interface{}) {
+	a.problems = append(a.problems, Problem{
+		File:     owner.file,
+		Resource: owner.String(),
+		Route:    route,
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Analyze resolves the delegation from the virtual services in the manifests to their route tables, by ref or by
+// selector, the way Gloo merges them into one list of routes, and reports the problems it finds, tied to the files
+// they're in. Destinations are only checked against upstreams if the manifests include some.
+func Analyze(manifests *charts.Manifests) ([]Problem, error) {
+	a := &analyzer{
+		upstreams: make(map[charts.ResourceRef]*charts.Upstream),
+		used:      make(map[*resource]bool),
+	}
+	if err := a.load(manifests); err != nil {
+		return nil, err
+	}
+	if len(a.virtualServices) == 0 {
+		return nil, NoVirtualServiceError()
+	}
+
+	for _, resources := range [][]*resource{a.virtualServices, a.routeTables} {
+		for _, r := range resources {
+			a.checkDestinations(r)
+		}
+	}
+	for _, vs := range a.virtualServices {
+		a.checkOrder(a.flatten(vs, nil, []*resource{vs}))
+	}
+	for _, rt := range a.routeTables {
+		if !a.used[rt] {
+			a.report(rt, -1, UnusedRouteTable, "no virtual service delegates to it, so none of its routes are served")
+		}
+	}
+	return a.sortedProblems(), nil
+}
+
+func (a *analyzer) load(manifests *charts.Manifests) error {
+	defined := make(map[string]*resource)
+	for _, object := range manifests.Objects {
+		r := &resource{
+			file:   object.Template,
+			kind:   object.Kind,
+			ref:    charts.ResourceRef{Name: object.Metadata.Name, Namespace: object.Metadata.Namespace},
+			labels: object.Metadata.Labels,
+		}
+		switch object.Kind {
+		case VirtualServiceKind:
+			var vs charts.VirtualService
+			if err := object.Decode(&vs); err != nil {
+				return err
+			}
+			r.routes = vs.Spec.VirtualHost.Routes
+		case RouteTableKind:
+			var rt charts.RouteTable
+			if err := object.Decode(&rt); err != nil {
+				return err
+			}
+			r.routes = rt.Spec.Routes
+			r.weight = rt.Spec.Weight
+		case UpstreamKind:
+			var us charts.Upstream
+			if err := object.Decode(&us); err != nil {
+				return err
+			}
+			a.upstreams[r.ref] = &us
+			continue
+		default:
+			continue
+		}
+
+		// Like kubectl apply, a later definition replaces an earlier one
+		if previous, ok := defined[r.String()]; ok {
+			a.report(r, -1, DuplicateDefinition, "it is also defined in %s, which this replaces", filepath.Base(previous.file))
+			*previous = *r
+			continue
+		}
+		defined[r.String()] = r
+		if r.kind == VirtualServiceKind {
+			a.virtualServices = append(a.virtualServices, r)
+		} else {
+			a.routeTables = append(a.routeTables, r)
+		}
+	}
+	return nil
+}
+
+// Flattens the routes of a resource, replacing each delegating route with the routes it delegates to, in order.
+func (a *analyzer) flatten(owner *resource, tiedWith map[*resource]bool, stack []*resource) []flatRoute {
+	var result []flatRoute
+	for i, route := range owner.routes {
+		current := flatRoute{owner: owner, index: i, route: route, tiedWith: tiedWith}
+		if route.DelegateAction == nil {
+			result = append(result, current)
+			continue
+		}
+		prefixes, ok := a.delegatingPrefixes(owner, i, route)
+		if !ok {
+			continue
+		}
+		children := a.delegates(owner, i, route.DelegateAction)
+		for _, child := range children {
+			if containsResource(stack, child) {
+				a.report(owner, i, InvalidDelegation, "delegates to %s, which already delegates back to it", child)
+				continue
+			}
+			a.used[child] = true
+			a.checkChildPrefixes(child, prefixes, current)
+			tied := make(map[*resource]bool)
+			for _, other := range children {
+				if other != child && other.weight == child.weight {
+					tied[other] = true
+				}
+			}
+			result = append(result, a.flatten(child, tied, append(stack, child))...)
+		}
+	}
+	return result
+}
+
+func containsResource(resources []*resource, r *resource) bool {
+	for _, other := range resources {
+		if other == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Gloo only delegates prefixes, so that the routes under them can be handed to route tables. It rejects a delegating
+// route with any other matcher, so nothing is delegated.
+func (a *analyzer) delegatingPrefixes(owner *resource, index int, route charts.Route) ([]string, bool) {
+	var prefixes []string
+	for _, matcher := range matchersOf(route) {
+		if matcher.Exact != "" || matcher.Regex != "" {
+			a.report(owner, index, InvalidDelegation, "delegates with an exact or regex matcher, but only prefixes can be delegated")
+			return nil, false
+		}
+		prefixes = append(prefixes, pathOf(matcher).value)
+	}
+	return prefixes, true
+}
+
+// The route tables a delegate action hands its prefix to, in the order Gloo merges them: by weight, and then by
+// namespace and name, although Gloo doesn't define the order of route tables with the same weight.
+func (a *analyzer) delegates(owner *resource, index int, action *charts.DelegateAction) []*resource {
+	if action.Selector == nil {
+		ref := charts.ResourceRef{Name: action.Name, Namespace: action.Namespace}
+		if action.Ref != nil {
+			ref = *action.Ref
+		}
+		if ref.Namespace == "" {
+			ref.Namespace = owner.ref.Namespace
+		}
+		for _, rt := range a.routeTables {
+			if rt.ref == ref {
+				return []*resource{rt}
+			}
+		}
+		a.report(owner, index, InvalidDelegation, "delegates to RouteTable %s.%s, which isn't in any of the files", ref.Namespace, ref.Name)
+		return nil
+	}
+
+	namespaces := action.Selector.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{owner.ref.Namespace}
+	}
+	var selected []*resource
+	for _, rt := range a.routeTables {
+		if selects(action.Selector, namespaces, rt) {
+			selected = append(selected, rt)
+		}
+	}
+	if len(selected) == 0 {
+		a.report(owner, index, InvalidDelegation, "selects no route tables with labels %v in namespaces %v",
+			action.Selector.Labels, namespaces)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].weight != selected[j].weight {
+			return selected[i].weight < selected[j].weight
+		}
+		return selected[i].String() < selected[j].String()
+	})
+	return selected
+}
+
+func selects(selector *charts.DelegateSelector, namespaces []string, rt *resource) bool {
+	inNamespace := false
+	for _, namespace := range namespaces {
+		if namespace == allNamespaces || namespace == rt.ref.Namespace {
+			inNamespace = true
+		}
+	}
+	if !inNamespace {
+		return false
+	}
+	for name, value := range selector.Labels {
+		if rt.labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Every route in a delegated route table has to stay under the prefix it was delegated, or Gloo rejects the table.
+func (a *analyzer) checkChildPrefixes(child *resource, prefixes []string, parent flatRoute) {
+	for i, route := range child.routes {
+		for _, matcher := range matchersOf(route) {
+			path := pathOf(matcher)
+			if path.regex {
+				continue
+			}
+			under := false
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(path.value, prefix) {
+					under = true
+				}
+			}
+			if !under {
+				a.report(child, i, InvalidDelegation, "matches %s, which isn't under %s, the prefix delegated to it by %s",
+					path.value, strings.Join(prefixes, " or "), parent.describe())
+			}
+		}
+	}
+}
+
+func (a *analyzer) checkDestinations(r *resource) {
+	for i, route := range r.routes {
+		action := route.RouteAction
+		if action == nil {
+			continue
+		}
+		var destinations []charts.Destination
+		if action.Single != nil {
+			destinations = append(destinations, *action.Single)
+		}
+		if action.Multi != nil {
+			if len(action.Multi.Destinations) > 0 && action.TotalWeight() == 0 {
+				a.report(r, i, InvalidDestination, "splits traffic between destinations whose weights add up to 0")
+			}
+			for _, weighted := range action.Multi.Destinations {
+				destinations = append(destinations, weighted.Destination)
+			}
+		}
+		if len(a.upstreams) == 0 {
+			continue
+		}
+		for _, destination := range destinations {
+			if message := a.checkDestination(destination); message != "" {
+				a.report(r, i, InvalidDestination, "%s", message)
+			}
+		}
+	}
+}
+
+func (a *analyzer) checkDestination(destination charts.Destination) string {
+	ref := destination.Upstream
+	upstream, ok := a.upstreams[ref]
+	if !ok {
+		return fmt.Sprintf("routes to Upstream %s.%s, which isn't in any of the files", ref.Namespace, ref.Name)
+	}
+	if destination.Subset == nil {
+		return ""
+	}
+	var keys []string
+	for key := range destination.Subset.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kube := upstream.Spec.Kube
+	if kube == nil || kube.SubsetSpec == nil {
+		return fmt.Sprintf("routes to a subset of Upstream %s.%s, which doesn't define any", ref.Namespace, ref.Name)
+	}
+	var defined []string
+	for _, selector := range kube.SubsetSpec.Selectors {
+		selectorKeys := append([]string{}, selector.Keys...)
+		sort.Strings(selectorKeys)
+		if reflect.DeepEqual(keys, selectorKeys) {
+			return ""
+		}
+		defined = append(defined, fmt.Sprint(selectorKeys))
+	}
+	return fmt.Sprintf("routes to a subset by %v, but Upstream %s.%s only has subsets by %s",
+		keys, ref.Namespace, ref.Name, strings.Join(defined, ", "))
+}
+
+// Envoy uses the first route that matches a request, so a route is never used if an earlier one matches everything
+// it does, and routes owned by different teams shouldn't compete for the same requests.
+func (a *analyzer) checkOrder(routes []flatRoute) {
+	for j, later := range routes {
+		for _, earlier := range routes[:j] {
+			sameOwner := earlier.owner == later.owner
+			// A route table delegated to from more than one route is merged in more than once
+			if sameOwner && earlier.index == later.index {
+				continue
+			}
+			if routeCovers(earlier.route, later.route) {
+				switch {
+				case sameOwner && reflect.DeepEqual(matchersOf(earlier.route), matchersOf(later.route)):
+					a.report(later.owner, later.index, ShadowedMatcher, "it is never used, since route %d has the same matchers",
+						earlier.index)
+				case sameOwner:
+					a.report(later.owner, later.index, OrderingProblem,
+						"it is never used, since route %d comes first and matches all of its requests; move it before route %d",
+						earlier.index, earlier.index)
+				case later.tiedWith[earlier.owner]:
+					a.report(later.owner, later.index, OrderingProblem,
+						"it is never used while %s matches all of its requests, and comes first only because of its name, since both "+
+							"route tables have the same weight and Gloo doesn't define their order; set a weight", earlier.describe())
+				default:
+					a.report(later.owner, later.index, ShadowedMatcher, "it is never used, since %s comes first and matches all of its requests",
+						earlier.describe())
+				}
+				break
+			}
+			if !sameOwner && routesOverlap(earlier.route, later.route) {
+				a.report(later.owner, later.index, OverlappingPrefixes, "some of its requests go to %s, which comes first",
+					earlier.describe())
+			}
+		}
+	}
+}
+
+func (a *analyzer) sortedProblems() []Problem {
+	seen := make(map[Problem]bool)
+	var result []Problem
+	for _, problem := range a.problems {
+		if !seen[problem] {
+			seen[problem] = true
+			result = append(result, problem)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		if result[i].Resource != result[j].Resource {
+			return result[i].Resource < result[j].Resource
+		}
+		return result[i].Route < result[j].Route
+	})
+	return result
+}
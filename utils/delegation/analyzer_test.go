@@ -0,0 +1,142 @@
+package delegation_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+	"github.com/solo-io/gloo-ref-arch/utils/delegation"
+)
+
+func TestDelegation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Delegation Analyzer Suite")
+}
+
+const (
+	part2 = "../../two-phased-canary/part2/"
+	part4 = "../../two-phased-canary/part4/"
+)
+
+var upstreams = []string{part2 + "upstream-echo.yaml", part2 + "upstream-foxtrot.yaml"}
+
+var _ = Describe("Route table delegation", func() {
+
+	problems := func(files ...string) []string {
+		manifests, err := charts.Load(files...)
+		Expect(err).NotTo(HaveOccurred())
+		problems, err := delegation.Analyze(manifests)
+		Expect(err).NotTo(HaveOccurred())
+		var descriptions []string
+		for _, problem := range problems {
+			descriptions = append(descriptions, problem.String())
+		}
+		return descriptions
+	}
+
+	withUpstreams := func(files ...string) []string {
+		return problems(append(files, upstreams...)...)
+	}
+
+	table.DescribeTable("accepts each stage of the part 2 workflow",
+		func(files ...string) {
+			Expect(withUpstreams(files...)).To(BeEmpty())
+		},
+		table.Entry("initial routes", part2+"vs.yaml", part2+"rt-echo-1.yaml", part2+"rt-foxtrot-1.yaml"),
+		table.Entry("foxtrot phase 1", part2+"vs.yaml", part2+"rt-echo-1.yaml", part2+"rt-foxtrot-2.yaml"),
+		table.Entry("foxtrot phase 2", part2+"vs.yaml", part2+"rt-echo-2.yaml", part2+"rt-foxtrot-4.yaml"),
+		table.Entry("finished foxtrot rollout", part2+"vs.yaml", part2+"rt-echo-2.yaml", part2+"rt-foxtrot-5.yaml"),
+		table.Entry("selected by label", part2+"vs-2.yaml", part2+"rt-echo-4.yaml", part2+"rt-foxtrot-6.yaml"),
+	)
+
+	It("ties the invalid echo destination to its file, without blaming the foxtrot team", func() {
+		Expect(withUpstreams(part2+"vs.yaml", part2+"rt-echo-3.yaml", part2+"rt-foxtrot-4.yaml")).To(ConsistOf(
+			"rt-echo-3.yaml: RouteTable echo.echo-routes route 0: invalid destination: routes to Upstream gloo-system.echo-typo, which isn't in any of the files",
+		))
+	})
+
+	It("only checks destinations against upstreams if there are some", func() {
+		Expect(problems(part2+"vs.yaml", part2+"rt-echo-3.yaml", part2+"rt-foxtrot-4.yaml")).To(BeEmpty())
+	})
+
+	It("reports route tables that are missing the label the virtual service selects", func() {
+		Expect(withUpstreams(part2+"vs-2.yaml", part2+"rt-echo-2.yaml", part2+"rt-foxtrot-6.yaml")).To(ConsistOf(
+			"rt-echo-2.yaml: RouteTable echo.echo-routes: unused route table: no virtual service delegates to it, so none of its routes are served",
+		))
+	})
+
+	It("reports delegation to route tables that aren't there", func() {
+		Expect(withUpstreams(part2+"vs.yaml", part2+"rt-echo-1.yaml")).To(ConsistOf(
+			"vs.yaml: VirtualService gloo-system.app route 1: invalid delegation: selects no route tables with labels map[] in namespaces [foxtrot]",
+		))
+	})
+
+	It("reports each definition that replaces an earlier one", func() {
+		Expect(withUpstreams(part2+"vs.yaml", part2+"rt-echo-1.yaml", part2+"rt-echo-2.yaml", part2+"rt-foxtrot-1.yaml")).To(ConsistOf(
+			"rt-echo-2.yaml: RouteTable echo.echo-routes: duplicate definition: it is also defined in rt-echo-1.yaml, which this replaces",
+		))
+	})
+
+	It("reports route tables selected in an undefined order that shadow each other", func() {
+		Expect(withUpstreams(part2+"vs-2.yaml", "testdata/rt-echo-catch-all.yaml", part2+"rt-foxtrot-6.yaml")).To(ConsistOf(
+			"rt-foxtrot-6.yaml: RouteTable foxtrot.foxtrot-routes route 0: ordering problem: it is never used while route 0 of RouteTable echo.echo-routes (rt-echo-catch-all.yaml) " +
+				"matches all of its requests, and comes first only because of its name, since both route tables have the same weight and Gloo doesn't define their order; set a weight",
+		))
+	})
+
+	It("orders route tables by weight, and still reports prefixes that overlap", func() {
+		Expect(withUpstreams(part2+"vs-2.yaml", "testdata/rt-echo-catch-all-weighted.yaml", part2+"rt-foxtrot-6.yaml")).To(ConsistOf(
+			"rt-echo-catch-all-weighted.yaml: RouteTable echo.echo-routes route 0: overlapping prefixes: some of its requests go to route 0 of RouteTable foxtrot.foxtrot-routes (rt-foxtrot-6.yaml), which comes first",
+		))
+	})
+
+	It("reports routes that come after routes that match all of their requests", func() {
+		Expect(withUpstreams(part2+"vs.yaml", "testdata/rt-echo-misordered.yaml", part2+"rt-foxtrot-1.yaml")).To(ConsistOf(
+			"rt-echo-misordered.yaml: RouteTable echo.echo-routes route 1: ordering problem: it is never used, since route 0 comes first and matches all of its requests; move it before route 0",
+			"rt-echo-misordered.yaml: RouteTable echo.echo-routes route 2: shadowed matcher: it is never used, since route 0 has the same matchers",
+		))
+	})
+
+	It("reports routes outside the delegated prefix, and the team whose requests they take", func() {
+		Expect(withUpstreams(part2+"vs.yaml", "testdata/rt-echo-outside-prefix.yaml", part2+"rt-foxtrot-1.yaml")).To(ConsistOf(
+			"rt-echo-outside-prefix.yaml: RouteTable echo.echo-routes route 0: invalid delegation: matches /foxtrot/admin, which isn't under /echo, "+
+				"the prefix delegated to it by route 0 of VirtualService gloo-system.app (vs.yaml)",
+			"rt-foxtrot-1.yaml: RouteTable foxtrot.foxtrot-routes route 0: overlapping prefixes: some of its requests go to route 0 of RouteTable echo.echo-routes (rt-echo-outside-prefix.yaml), which comes first",
+		))
+	})
+
+	It("reports subsets the upstream doesn't have, and splits without weights", func() {
+		Expect(withUpstreams(part2+"vs.yaml", "testdata/rt-echo-subsets.yaml", part2+"rt-foxtrot-1.yaml")).To(ConsistOf(
+			"rt-echo-subsets.yaml: RouteTable echo.echo-routes route 0: invalid destination: routes to a subset by [stage], but Upstream gloo-system.echo only has subsets by [version]",
+			"rt-echo-subsets.yaml: RouteTable echo.echo-routes route 1: invalid destination: splits traffic between destinations whose weights add up to 0",
+		))
+	})
+
+	It("resolves delegation by ref", func() {
+		Expect(withUpstreams("testdata/vs-ref.yaml", part2+"rt-echo-2.yaml", part2+"rt-foxtrot-1.yaml")).To(ConsistOf(
+			"vs-ref.yaml: VirtualService gloo-system.app route 0: invalid delegation: delegates with an exact or regex matcher, but only prefixes can be delegated",
+			"vs-ref.yaml: VirtualService gloo-system.app route 2: invalid delegation: delegates to RouteTable foxtrot.foxtrot-routs, which isn't in any of the files",
+			"rt-foxtrot-1.yaml: RouteTable foxtrot.foxtrot-routes: unused route table: no virtual service delegates to it, so none of its routes are served",
+		))
+	})
+
+	It("needs a virtual service", func() {
+		manifests, err := charts.Load(part2 + "rt-echo-1.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = delegation.Analyze(manifests)
+		Expect(err).To(MatchError("None of the files define a VirtualService"))
+	})
+
+	It("checks route tables rendered by the gloo-app chart", func() {
+		manifests, err := charts.Render(part4+"gloo-app", charts.Release{Name: "echo", Namespace: "echo"}, part4+"values-4.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		vs, err := charts.Load(part4 + "vs.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		manifests.Objects = append(manifests.Objects, vs.Objects...)
+		problems, err := delegation.Analyze(manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(BeEmpty())
+	})
+})
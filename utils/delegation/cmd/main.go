@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+	"github.com/solo-io/gloo-ref-arch/utils/delegation"
+)
+
+type valuesFlags []string
+
+func (v *valuesFlags) String() string {
+	return fmt.Sprint([]string(*v))
+}
+
+func (v *valuesFlags) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+// Checks a virtual service and the route tables it delegates to, given as the manifest files that would be applied
+// together, e.g. vs.yaml rt-echo-3.yaml rt-foxtrot-4.yaml upstream-echo.yaml upstream-foxtrot.yaml. The objects a
+// chart renders can be checked along with them. Exits non-zero if there are any problems, printing each with the
+// file it's in.
+func main() {
+	var valuesFiles valuesFlags
+	chart := flag.String("chart", "", "chart directory whose rendered objects are checked along with the files, e.g. gloo-app")
+	release := flag.String("release", "", "release name and namespace to render the chart for, e.g. echo")
+	flag.Var(&valuesFiles, "values", "values file to render the chart with, may be repeated")
+	flag.Parse()
+
+	manifests, err := charts.Load(flag.Args()...)
+	if err == nil && *chart != "" {
+		var rendered *charts.Manifests
+		rendered, err = charts.Render(*chart, charts.Release{Name: *release, Namespace: *release}, valuesFiles...)
+		if err == nil {
+			manifests.Objects = append(manifests.Objects, rendered.Objects...)
+		}
+	}
+	var problems []delegation.Problem
+	if err == nil {
+		problems, err = delegation.Analyze(manifests)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("No problems with the routes in %d objects\n", len(manifests.Objects))
+}
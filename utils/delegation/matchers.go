@@ -0,0 +1,120 @@
+package delegation
+
+import (
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/charts"
+)
+
+// The path part of a matcher. Regexes are only compared to each other as strings, so they never cover or overlap
+// anything but the same regex.
+type path struct {
+	value  string
+	prefix bool
+	regex  bool
+}
+
+// A route without matchers, or a matcher without a path, matches the / prefix.
+func matchersOf(route charts.Route) []charts.Matcher {
+	if len(route.Matchers) == 0 {
+		return []charts.Matcher{{}}
+	}
+	return route.Matchers
+}
+
+func pathOf(matcher charts.Matcher) path {
+	switch {
+	case matcher.Exact != "":
+		return path{value: matcher.Exact}
+	case matcher.Regex != "":
+		return path{value: matcher.Regex, regex: true}
+	case matcher.Prefix != "":
+		return path{value: matcher.Prefix, prefix: true}
+	}
+	return path{value: defaultPrefix, prefix: true}
+}
+
+// Whether every request path b matches is matched by a.
+func (a path) covers(b path) bool {
+	switch {
+	case a.regex || b.regex:
+		return a == b
+	case a.prefix:
+		return strings.HasPrefix(b.value, a.value)
+	}
+	return !b.prefix && a.value == b.value
+}
+
+func (a path) overlaps(b path) bool {
+	return a.covers(b) || b.covers(a) ||
+		(!a.regex && !b.regex && !a.prefix && b.prefix && strings.HasPrefix(a.value, b.value))
+}
+
+// Whether a requires a subset of b's headers, so it matches every request b does.
+func headersCover(a, b []charts.HeaderMatcher) bool {
+	for _, header := range a {
+		found := false
+		for _, other := range b {
+			if header == other {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether no request can match both a and b, because they need different values of the same header.
+func headersConflict(a, b []charts.HeaderMatcher) bool {
+	for _, header := range a {
+		for _, other := range b {
+			if header.Name != other.Name || header.Regex || other.Regex {
+				continue
+			}
+			if header.InvertMatch == other.InvertMatch && header.Value != other.Value && !header.InvertMatch {
+				return true
+			}
+			if header.InvertMatch != other.InvertMatch && header.Value == other.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matcherCovers(a, b charts.Matcher) bool {
+	return pathOf(a).covers(pathOf(b)) && headersCover(a.Headers, b.Headers)
+}
+
+func matchersOverlap(a, b charts.Matcher) bool {
+	return pathOf(a).overlaps(pathOf(b)) && !headersConflict(a.Headers, b.Headers)
+}
+
+// Whether a route matches every request another one does.
+func routeCovers(a, b charts.Route) bool {
+	for _, other := range matchersOf(b) {
+		covered := false
+		for _, matcher := range matchersOf(a) {
+			if matcherCovers(matcher, other) {
+				covered = true
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func routesOverlap(a, b charts.Route) bool {
+	for _, matcher := range matchersOf(a) {
+		for _, other := range matchersOf(b) {
+			if matchersOverlap(matcher, other) {
+				return true
+			}
+		}
+	}
+	return false
+}
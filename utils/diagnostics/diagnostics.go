@@ -0,0 +1,178 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/solo-io/go-utils/testutils"
+)
+
+const (
+	GlooNamespace  = "gloo-system"
+	OutputDir      = "_output"
+	commandTimeout = 30 * time.Second
+)
+
+var (
+	// Deployments whose logs are included in the bundle. Missing deployments (i.e. extauth and
+	// rate-limit on open source installs) are recorded as errors in the bundle and otherwise ignored.
+	Deployments = []string{"gloo", "gateway", "discovery", "extauth", "rate-limit", "gateway-proxy"}
+
+	// Gloo custom resources included in the bundle, across all namespaces and including status.
+	Resources = []string{
+		"proxies.gloo.solo.io",
+		"settings.gloo.solo.io",
+		"upstreams.gloo.solo.io",
+		"upstreamgroups.gloo.solo.io",
+		"gateways.gateway.solo.io",
+		"virtualservices.gateway.solo.io",
+		"routetables.gateway.solo.io",
+		"authconfigs.enterprise.gloo.solo.io",
+	}
+)
+
+type entry struct {
+	name    string
+	command []string
+}
+
+func entries() []entry {
+	var result []entry
+	for _, deployment := range Deployments {
+		result = append(result, entry{
+			name:    fmt.Sprintf("logs/%s.log", deployment),
+			command: []string{"kubectl", "logs", "-n", GlooNamespace, "deploy/" + deployment, "--all-containers"},
+		})
+	}
+	for _, resource := range Resources {
+		result = append(result, entry{
+			name:    fmt.Sprintf("resources/%s.yaml", resource),
+			command: []string{"kubectl", "get", resource, "--all-namespaces", "-o", "yaml"},
+		})
+	}
+	result = append(result,
+		entry{
+			name:    "envoy/config_dump.json",
+			command: []string{"glooctl", "proxy", "dump"},
+		},
+		entry{
+			name:    "events.txt",
+			command: []string{"kubectl", "get", "events", "--all-namespaces", "--sort-by=.lastTimestamp"},
+		},
+		entry{
+			name:    "pods.txt",
+			command: []string{"kubectl", "get", "pods", "--all-namespaces", "-o", "wide"},
+		})
+	return result
+}
+
+// Collect writes a timestamped tarball with logs, Gloo resources, the Envoy config dump and recent
+// events to dir/_output, and returns its path. Failures of individual commands are captured in the
+// bundle rather than returned, since a partial bundle is still useful for debugging.
+func Collect(dir string) (string, error) {
+	outputDir := filepath.Join(dir, OutputDir)
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join(outputDir, fmt.Sprintf("diagnostics-%s.tgz", time.Now().Format("20060102-150405")))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for _, e := range entries() {
+		if err := writeEntry(tw, e.name, output(e.command)); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// RegisterFailHandlers takes the place of testutils.RegisterCommonFailHandlers in workflow suites. On failure, it
+// prints the trimmed stack, collects a bundle into dir/_output, waits if WAIT_ON_FAIL asks it to, and fails with the
+// bundle's path in the message.
+func RegisterFailHandlers(dir string) {
+	gomega.RegisterFailHandler(FailHandler(dir, ginkgo.Fail))
+}
+
+// FailHandler wraps fail, collecting a bundle into dir/_output when a test fails, and appending its path to the
+// failure message so that it shows in the test report.
+func FailHandler(dir string, fail types.GomegaFailHandler) types.GomegaFailHandler {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	return func(message string, callerSkip ...int) {
+		testutils.PrintTrimmedStack()
+		path, err := Collect(absDir)
+		if err != nil {
+			message = fmt.Sprintf("%s\nFailed to collect diagnostics bundle: %v", message, err)
+		} else {
+			fmt.Fprintf(ginkgo.GinkgoWriter, "Diagnostics bundle for this failure: %s\n", path)
+			message = fmt.Sprintf("%s\nDiagnostics bundle: %s", message, path)
+		}
+		waitOnFail()
+		// Skip this handler's frame, so that the failure is reported where the assertion was made
+		skip := 1
+		if len(callerSkip) > 0 {
+			skip += callerSkip[0]
+		}
+		fail(message, skip)
+	}
+}
+
+// Like the common fail handlers, waits for SIGUSR1 before failing when WAIT_ON_FAIL is 1, or a debugger is attached
+// and WAIT_ON_FAIL isn't 0, so that the cluster can be inspected before the workflow moves on.
+func waitOnFail() {
+	if os.Getenv("WAIT_ON_FAIL") == "0" {
+		return
+	}
+	if os.Getenv("WAIT_ON_FAIL") == "1" || testutils.IsDebuggerPresent() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGUSR1)
+		defer signal.Stop(c)
+		fmt.Printf("Waiting for human intervention. To continue, run 'kill -SIGUSR1 %d'\n", os.Getpid())
+		<-c
+	}
+}
+
+func output(command []string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		out = append(out, []byte(fmt.Sprintf("\n# %s: %v\n", strings.Join(command, " "), err))...)
+	}
+	return out
+}
+
+func writeEntry(tw *tar.Writer, name string, contents []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(contents)
+	return err
+}
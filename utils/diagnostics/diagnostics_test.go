@@ -0,0 +1,75 @@
+package diagnostics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+)
+
+func TestDiagnostics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diagnostics Suite")
+}
+
+var _ = Describe("Fail handler", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "diagnostics-")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("collects a bundle, and adds its path to the failure message", func() {
+		var message string
+		var skip []int
+		diagnostics.FailHandler(dir, func(m string, callerSkip ...int) {
+			message, skip = m, callerSkip
+		})("assertion failed", 2)
+
+		bundles, err := filepath.Glob(filepath.Join(dir, diagnostics.OutputDir, "diagnostics-*.tgz"))
+		Expect(err).To(BeNil())
+		Expect(bundles).To(HaveLen(1))
+		Expect(message).To(Equal("assertion failed\nDiagnostics bundle: " + bundles[0]))
+		Expect(skip).To(Equal([]int{3}))
+	})
+
+	Context("with WAIT_ON_FAIL=1", func() {
+		BeforeEach(func() {
+			os.Setenv("WAIT_ON_FAIL", "1")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("WAIT_ON_FAIL")
+		})
+
+		It("waits for SIGUSR1 before failing", func() {
+			// Keeps SIGUSR1 from killing the test before the handler listens for it
+			ignored := make(chan os.Signal, 10)
+			signal.Notify(ignored, syscall.SIGUSR1)
+			defer signal.Stop(ignored)
+
+			failed := make(chan string, 1)
+			go diagnostics.FailHandler(dir, func(m string, callerSkip ...int) {
+				failed <- m
+			})("assertion failed")
+
+			Consistently(failed, "200ms").ShouldNot(Receive())
+			Eventually(func() <-chan string {
+				syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+				return failed
+			}, "5s", "100ms").Should(Receive(HavePrefix("assertion failed\n")))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package gloo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// Envoy flushes file sinks periodically, and may not have loaded the access log config yet, so assertions
+	// retry for a while before failing.
+	accessLogAttempts = 30
+	// Markers are stored locally, relative to the workflow directory.
+	accessLogMarkerDir = "_output/access-log-markers"
+)
+
+func gatewayProxyExec(command string) string {
+	return fmt.Sprintf("kubectl exec -n gloo-system deploy/gateway-proxy -c gateway-proxy -- %s", command)
+}
+
+func accessLogMarkerFile(path, marker string) string {
+	return fmt.Sprintf("%s/%s-%s", accessLogMarkerDir, marker, filepath.Base(path))
+}
+
+// MarkAccessLog records how many entries the file sink at path currently holds, so that
+// assertions using the same marker only consider entries produced by later requests.
+func MarkAccessLog(path, marker string) *workflow.Step {
+	lines := []string{
+		"set -e",
+		fmt.Sprintf("mkdir -p %s", accessLogMarkerDir),
+		fmt.Sprintf("%s | tr -d ' ' > %s", gatewayProxyExec(fmt.Sprintf("sh -c 'cat %s 2>/dev/null | wc -l'", path)), accessLogMarkerFile(path, marker)),
+	}
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// AssertAccessLogLine sends a request for requestPath through the http listener until an entry matching the
+// extended regular expression pattern is written to a string-formatted file sink after the marker. Requests are
+// sent on every attempt, since the first ones may be served before Envoy loads the access log config.
+func AssertAccessLogLine(path, marker, requestPath, pattern string) *workflow.Step {
+	return assertAccessLog(path, marker, requestPath, []string{pattern}, fmt.Sprintf("matching %s", pattern))
+}
+
+// AssertAccessLogFields is like AssertAccessLogLine, for an entry with all of the given fields in a
+// JSON-formatted file sink. Field values are extended regular expressions.
+func AssertAccessLogFields(path, marker, requestPath string, fields map[string]string) *workflow.Step {
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var patterns, descriptions []string
+	for _, k := range keys {
+		patterns = append(patterns, fmt.Sprintf(`"%s": *"?%s"?[,}]`, k, fields[k]))
+		descriptions = append(descriptions, fmt.Sprintf("%s=%s", k, fields[k]))
+	}
+	return assertAccessLog(path, marker, requestPath, patterns, fmt.Sprintf("with %s", strings.Join(descriptions, ", ")))
+}
+
+func assertAccessLog(path, marker, requestPath string, patterns []string, description string) *workflow.Step {
+	var filters []string
+	for _, pattern := range patterns {
+		filters = append(filters, fmt.Sprintf("grep -E '%s'", pattern))
+	}
+	filter := strings.Join(filters, " | ")
+	lines := append(bash.PortForwardLines(bash.GatewayProxy(httpPort, httpPort)),
+		fmt.Sprintf(`offset="$(cat %s 2>/dev/null || echo 0)"`, accessLogMarkerFile(path, marker)))
+	lines = append(lines, bash.RetryLines(accessLogAttempts, 1, []string{
+		fmt.Sprintf("curl -s -o /dev/null http://localhost:%d%s", httpPort, requestPath),
+		fmt.Sprintf(`entries="$(%s | tail -n +$((offset + 1)))"`, gatewayProxyExec("cat "+path)),
+		fmt.Sprintf(`if [ -n "$(echo "$entries" | %s)" ]; then echo 'Found access log entry in %s %s'; exit 0; fi`, filter, path, description),
+	}, fmt.Sprintf("an access log entry in %s %s since marker %s", path, description, marker),
+		"echo 'Entries since marker:'",
+		`echo "$entries"`)...)
+	return bash.Step(lines...)
+}
@@ -0,0 +1,134 @@
+package gloo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	discoveryAttempts = 60
+	discoveryDelay    = "2s"
+	// Gloo reports accepted resources with state 1.
+	acceptedState = "1"
+)
+
+// The kinds of functions discovery can find on an upstream, with a go-template listing their names.
+type FunctionKind struct {
+	Name     string
+	Template string
+}
+
+var (
+	// REST functions, discovered from a Swagger / OpenAPI spec.
+	RestFunctions = FunctionKind{
+		Name:     "REST",
+		Template: `{{range $name, $_ := .spec.kube.serviceSpec.rest.transformations}}{{$name}}{{"\n"}}{{end}}`,
+	}
+	// Lambda functions, discovered with the credentials on an AWS upstream.
+	LambdaFunctions = FunctionKind{
+		Name:     "Lambda",
+		Template: `{{range .spec.aws.lambdaFunctions}}{{.logicalName}}{{"\n"}}{{end}}`,
+	}
+)
+
+// The name discovery gives the upstream for a port on a kube service.
+func DiscoveredUpstreamName(namespace, service string, port int) string {
+	return fmt.Sprintf("%s-%s-%d", namespace, service, port)
+}
+
+func getUpstream(name, output string) string {
+	return fmt.Sprintf("kubectl get upstreams.gloo.solo.io -n gloo-system %s -o '%s' 2>/dev/null", name, output)
+}
+
+// A check for waitForDiscovery. The prelude runs once before waiting, and onTimeout adds
+// details to the failure, before the upstream and discovery logs are printed.
+type discoveryCheck struct {
+	prelude     []string
+	condition   string
+	description string
+	onTimeout   []string
+}
+
+// Waits for a condition, and prints the upstream and discovery logs if it isn't met in time.
+func waitForDiscovery(upstream string, check discoveryCheck) *workflow.Step {
+	lines := append([]string{}, check.prelude...)
+	lines = append(lines,
+		fmt.Sprintf("for i in $(seq %d); do", discoveryAttempts),
+		fmt.Sprintf("  if %s; then echo '%s'; exit 0; fi", check.condition, check.description),
+		fmt.Sprintf("  sleep %s", discoveryDelay),
+		"done",
+		fmt.Sprintf("echo 'Timed out waiting: %s'", check.description))
+	lines = append(lines, check.onTimeout...)
+	lines = append(lines,
+		fmt.Sprintf("kubectl get upstreams.gloo.solo.io -n gloo-system %s -o yaml", upstream),
+		"kubectl logs -n gloo-system deploy/discovery --tail=100",
+		"exit 1")
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// WaitForDiscoveredUpstream waits until discovery has created the upstream for a port on a kube service,
+// and Gloo has accepted it.
+func WaitForDiscoveredUpstream(namespace, service string, port int) *workflow.Step {
+	upstream := DiscoveredUpstreamName(namespace, service, port)
+	return waitForDiscovery(upstream, discoveryCheck{
+		condition:   fmt.Sprintf(`[ "$(%s)" == "%s" ]`, getUpstream(upstream, "jsonpath={.status.state}"), acceptedState),
+		description: fmt.Sprintf("upstream %s discovered and accepted", upstream),
+	})
+}
+
+// WaitForDiscoveredFunctions waits until function discovery has added at least one function of the given kind to the upstream.
+func WaitForDiscoveredFunctions(upstream string, kind FunctionKind) *workflow.Step {
+	return waitForDiscovery(upstream, discoveryCheck{
+		condition:   fmt.Sprintf(`[ -n "$(%s)" ]`, getUpstream(upstream, "go-template="+kind.Template)),
+		description: fmt.Sprintf("%s functions discovered on upstream %s", kind.Name, upstream),
+	})
+}
+
+// AssertDiscoveredFunctions waits until function discovery has added all of the named functions of the given kind
+// to the upstream. On timeout, the missing functions are reported along with the upstream and discovery logs.
+func AssertDiscoveredFunctions(upstream string, kind FunctionKind, names ...string) *workflow.Step {
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("'%s'", name))
+	}
+	prelude := []string{
+		"missing_functions() {",
+		fmt.Sprintf(`  found="$(%s)"`, getUpstream(upstream, "go-template="+kind.Template)),
+		`  missing=""`,
+		fmt.Sprintf(`  for name in %s; do echo "$found" | grep -qxF "$name" || missing="$missing $name"; done`, strings.Join(quoted, " ")),
+		`  [ -n "$missing" ]`,
+		"}",
+	}
+	return waitForDiscovery(upstream, discoveryCheck{
+		prelude:     prelude,
+		condition:   "! missing_functions",
+		description: fmt.Sprintf("%s functions %s discovered on upstream %s", kind.Name, strings.Join(names, ", "), upstream),
+		onTimeout: []string{
+			`echo "Missing:$missing"`,
+			`echo "Discovered: $(echo $found)"`,
+		},
+	})
+}
+
+// Names evaluates the kind's template against an upstream the same way kubectl does,
+// returning the function names it lists.
+func (k FunctionKind) Names(upstream map[string]interface{}) ([]string, error) {
+	tmpl, err := template.New(k.Name).Parse(k.Template)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, upstream); err != nil {
+		return nil, err
+	}
+	return strings.Fields(out.String()), nil
+}
@@ -0,0 +1,113 @@
+package gloo_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+)
+
+func TestGloo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gloo Steps Suite")
+}
+
+func loadUpstream(name string) map[string]interface{} {
+	contents, err := ioutil.ReadFile(filepath.Join("testdata", fmt.Sprintf("upstream-%s.yaml", name)))
+	Expect(err).To(BeNil())
+	var upstream map[string]interface{}
+	Expect(yaml.Unmarshal(contents, &upstream)).To(BeNil())
+	return upstream
+}
+
+// The templates are checked against the upstreams in testdata, which are written in the shape discovery leaves them
+// in. Discovery itself isn't run offline.
+var _ = Describe("Discovered functions", func() {
+
+	It("lists discovered REST functions", func() {
+		names, err := gloo.RestFunctions.Names(loadUpstream("default-petstore-8080"))
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"addPet", "deletePet", "findPetById", "findPets"}))
+	})
+
+	It("lists discovered Lambda functions", func() {
+		names, err := gloo.LambdaFunctions.Names(loadUpstream("aws"))
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"contact-form", "contact-form:3"}))
+	})
+
+	It("lists nothing for upstreams without functions of that kind", func() {
+		names, err := gloo.LambdaFunctions.Names(loadUpstream("default-petstore-8080"))
+		Expect(err).To(BeNil())
+		Expect(names).To(BeEmpty())
+	})
+
+	Context("asserting on an upstream", func() {
+		var binDir string
+
+		BeforeEach(func() {
+			var err error
+			binDir, err = ioutil.TempDir("", "fake-kubectl-")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(binDir)
+		})
+
+		// Runs the step with a kubectl that only answers the exact command that gets the upstream with the kind's
+		// template, printing the given names, and records the arguments of each call. Discovery itself isn't run
+		// here; the workflows that use the step check it against a cluster.
+		runWithFakeKubectl := func(step, upstream string, kind gloo.FunctionKind, names ...string) (string, error) {
+			expected := fmt.Sprintf("get upstreams.gloo.solo.io -n gloo-system %s -o go-template=%s", upstream, kind.Template)
+			Expect(ioutil.WriteFile(filepath.Join(binDir, "expected-args"), []byte(expected), 0644)).To(BeNil())
+			fake := fmt.Sprintf(`#!/bin/bash
+echo "$*" >> %[1]s/calls
+[ "$*" == "$(cat %[1]s/expected-args)" ] || exit 1
+printf '%%s\n' %[2]s
+`, binDir, strings.Join(quote(names), " "))
+			Expect(ioutil.WriteFile(filepath.Join(binDir, "kubectl"), []byte(fake), 0755)).To(BeNil())
+			// Don't wait around for functions that won't show up.
+			step = strings.Replace(step, "sleep 2s", "sleep 0", 1)
+			cmd := exec.Command("bash", "-c", step)
+			cmd.Env = append(os.Environ(), fmt.Sprintf("PATH=%s:%s", binDir, os.Getenv("PATH")))
+			out, err := cmd.CombinedOutput()
+			calls, readErr := ioutil.ReadFile(filepath.Join(binDir, "calls"))
+			Expect(readErr).To(BeNil())
+			// Later calls print the upstream and discovery logs on timeout
+			Expect(strings.Split(string(calls), "\n")[0]).To(Equal(expected))
+			return string(out), err
+		}
+
+		It("succeeds when all the functions were discovered", func() {
+			step := gloo.AssertDiscoveredFunctions("aws", gloo.LambdaFunctions, "contact-form:3")
+			out, err := runWithFakeKubectl(step.Bash.Inline, "aws", gloo.LambdaFunctions, "contact-form", "contact-form:3")
+			Expect(err).To(BeNil(), out)
+			Expect(out).To(ContainSubstring("Lambda functions contact-form:3 discovered on upstream aws"))
+		})
+
+		It("reports the missing functions", func() {
+			step := gloo.AssertDiscoveredFunctions("default-petstore-8080", gloo.RestFunctions, "findPets", "updatePet")
+			out, err := runWithFakeKubectl(step.Bash.Inline, "default-petstore-8080", gloo.RestFunctions, "addPet", "deletePet", "findPetById", "findPets")
+			Expect(err).NotTo(BeNil())
+			Expect(out).To(ContainSubstring("Missing: updatePet\n"))
+			Expect(out).To(ContainSubstring("Discovered: addPet deletePet findPetById findPets\n"))
+		})
+	})
+})
+
+func quote(names []string) []string {
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("'%s'", name))
+	}
+	return quoted
+}
@@ -0,0 +1,52 @@
+package gloo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// Gateways are backed up locally, relative to the workflow directory.
+const gatewayBackupFile = "_output/gateways.yaml"
+
+// Server-populated metadata that would make the backup conflict with the live objects when it is re-applied.
+var gatewayBackupIgnoredFields = []string{"resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"}
+
+// BackupGateways saves the gateways in gloo-system before a workflow replaces them. An existing backup is kept,
+// so that re-running a workflow that failed before restoring them doesn't back up the replacements.
+func BackupGateways() *workflow.Step {
+	var filters []string
+	for _, field := range gatewayBackupIgnoredFields {
+		filters = append(filters, fmt.Sprintf(`-e '/^    %s:/d'`, field))
+	}
+	lines := []string{
+		"set -e",
+		fmt.Sprintf(`[ ! -f %s ] || { echo "Keeping existing gateway backup %s"; exit 0; }`, gatewayBackupFile, gatewayBackupFile),
+		"mkdir -p $(dirname " + gatewayBackupFile + ")",
+		fmt.Sprintf("kubectl get gateways.gateway.solo.io -n gloo-system -o yaml | sed %s > %s",
+			strings.Join(filters, " "), gatewayBackupFile),
+		fmt.Sprintf(`echo "Backed up gateways to %s"`, gatewayBackupFile),
+	}
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// RestoreGateways re-applies the gateways saved by BackupGateways, and removes the backup.
+func RestoreGateways() *workflow.Step {
+	lines := []string{
+		"set -e",
+		fmt.Sprintf(`[ -f %s ] || { echo "No gateway backup to restore"; exit 0; }`, gatewayBackupFile),
+		fmt.Sprintf("kubectl apply -f %s", gatewayBackupFile),
+		fmt.Sprintf("rm %s", gatewayBackupFile),
+	}
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package gloo
+
+import (
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// The gateway-proxy http listener, which is port-forwarded to the same local port.
+	httpPort        = 8080
+	headersAttempts = 30
+)
+
+// The valet curl check only inspects the status and body, so response headers are checked with curl directly.
+func curlHeadersUntil(path, condition, description string) *workflow.Step {
+	lines := append(bash.PortForwardLines(bash.GatewayProxy(httpPort, httpPort)),
+		bash.RetryLines(headersAttempts, 1, []string{
+			fmt.Sprintf(`headers="$(curl -sS -o /dev/null -D - http://localhost:%d%s 2>&1 | tr -d '\r')"`, httpPort, path),
+			fmt.Sprintf("if %s; then echo %s; exit 0; fi", condition, bash.Quote(description)),
+		}, description,
+			"echo 'Last response headers:'",
+			`echo "$headers"`)...)
+	return bash.Step(lines...)
+}
+
+// CurlResponseHeader waits until a request to the path gets a successful response with the header containing the value.
+func CurlResponseHeader(path, header, value string) *workflow.Step {
+	return curlHeadersUntil(path,
+		fmt.Sprintf(`echo "$headers" | head -1 | grep -q ' 2[0-9][0-9]' && echo "$headers" | grep -i '^%s:' | grep -qF '%s'`, header, value),
+		fmt.Sprintf("%s responded with header %s: %s", path, header, value))
+}
+
+// CurlWithoutResponseHeader waits until a request to the path gets a successful response without the header.
+func CurlWithoutResponseHeader(path, header string) *workflow.Step {
+	return curlHeadersUntil(path,
+		fmt.Sprintf(`echo "$headers" | head -1 | grep -q ' 2[0-9][0-9]' && ! echo "$headers" | grep -qi '^%s:'`, header),
+		fmt.Sprintf("%s responded without header %s", path, header))
+}
+
+// CurlRedirect waits until a request to the path is redirected to a location containing the value, e.g. an
+// unauthenticated request that extauth sends to the identity provider to log in.
+func CurlRedirect(path, location string) *workflow.Step {
+	return curlHeadersUntil(path,
+		fmt.Sprintf(`echo "$headers" | head -1 | grep -q ' 302' && echo "$headers" | grep -i '^location:' | grep -qF '%s'`, location),
+		fmt.Sprintf("%s redirected to %s", path, location))
+}
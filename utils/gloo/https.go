@@ -0,0 +1,84 @@
+package gloo
+
+import (
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// The gateway-proxy https listener, which is port-forwarded to the same local port.
+	httpsPort     = 8443
+	httpsAttempts = 30
+)
+
+// Curl exits with 60 (or 51 on older versions) when the server certificate can't be verified for the host.
+const curlCertificateErrors = "51|60"
+
+// The curl command for a domain served by the https listener. The domain is resolved to the port-forward,
+// so that the SNI and Host headers match what a client would send. Without a CA, the certificate isn't verified.
+func httpsCurl(domain, path, caCert string) string {
+	verify := "-k"
+	if caCert != "" {
+		verify = "--cacert " + caCert
+	}
+	return fmt.Sprintf(`curl -sS --resolve %s:%d:127.0.0.1 %s -H "Host: %s" https://%s:%d%s`,
+		domain, httpsPort, verify, domain, domain, httpsPort, path)
+}
+
+func curlHttpsUntil(domain, path, caCert, condition, description string) *workflow.Step {
+	lines := append(bash.PortForwardLines(bash.GatewayProxy(httpsPort, httpsPort)),
+		bash.RetryLines(httpsAttempts, 1, []string{
+			fmt.Sprintf(`out="$(%s 2>&1)"; code=$?`, httpsCurl(domain, path, caCert)),
+			fmt.Sprintf("if %s; then echo %s; exit 0; fi", condition, bash.Quote(description)),
+		}, description,
+			`echo "Last response (curl exit code $code):"`,
+			`echo "$out"`)...)
+	return bash.Step(lines...)
+}
+
+// CurlHttps waits until an https request for the domain, verified against the CA, gets a response containing the substring.
+// If caCert is empty, the certificate isn't verified.
+func CurlHttps(domain, path, caCert, substring string) *workflow.Step {
+	return curlHttpsUntil(domain, path, caCert,
+		fmt.Sprintf(`[ $code -eq 0 ] && echo "$out" | grep -qF '%s'`, substring),
+		fmt.Sprintf("https://%s%s responded with %s", domain, path, substring))
+}
+
+// CurlHttpsCertificateError waits until the certificate served for the domain fails verification against the CA,
+// i.e. because the virtual service uses a certificate for a different domain.
+func CurlHttpsCertificateError(domain, caCert string) *workflow.Step {
+	return curlHttpsUntil(domain, "/", caCert,
+		fmt.Sprintf(`echo $code | grep -qxE '%s'`, curlCertificateErrors),
+		fmt.Sprintf("certificate for https://%s failed verification", domain))
+}
+
+// AssertServedCertificate waits until the https listener presents the certificate stored in a kubernetes.io/tls secret
+// for the domain, showing that Envoy terminates TLS with it. Certificates are compared by fingerprint, so this
+// doesn't depend on the certificate being valid.
+func AssertServedCertificate(domain, namespace, secret string) *workflow.Step {
+	return assertCertificate(bash.GatewayProxy(httpsPort, httpsPort), domain, namespace, secret, "https listener")
+}
+
+// AssertUpstreamCertificate waits until a deployment's TLS port presents the certificate stored in a kubernetes.io/tls
+// secret in its namespace, bypassing Envoy. Along with AssertServedCertificate, this shows whether Envoy terminates
+// TLS with its own certificate or passes it through to the upstream.
+func AssertUpstreamCertificate(domain, namespace, deployment string, port int, secret string) *workflow.Step {
+	portForward := bash.PortForward{Namespace: namespace, Resource: "deploy/" + deployment, Port: port, LocalPort: port}
+	return assertCertificate(portForward, domain, namespace, secret, fmt.Sprintf("%s.%s port %d", namespace, deployment, port))
+}
+
+func assertCertificate(portForward bash.PortForward, domain, namespace, secret, server string) *workflow.Step {
+	fingerprint := "openssl x509 -noout -fingerprint -sha256"
+	served := fmt.Sprintf("%s serves the certificate from %s.%s for %s", server, namespace, secret, domain)
+	lines := append(bash.PortForwardLines(portForward),
+		fmt.Sprintf(`expected="$(kubectl get secret -n %s %s -o 'jsonpath={.data.tls\.crt}' | base64 -d | %s)"`, namespace, secret, fingerprint))
+	lines = append(lines, bash.RetryLines(httpsAttempts, 1, []string{
+		fmt.Sprintf(`served="$(openssl s_client -connect 127.0.0.1:%d -servername %s </dev/null 2>/dev/null | %s 2>/dev/null)"`, portForward.LocalPort, domain, fingerprint),
+		fmt.Sprintf(`if [ -n "$served" ] && [ "$served" == "$expected" ]; then echo %s; exit 0; fi`, bash.Quote(served)),
+	}, fmt.Sprintf("the %s to serve the certificate from %s.%s for %s", server, namespace, secret, domain),
+		`echo "Expected: $expected"`,
+		`echo "Served: $served"`)...)
+	return bash.Step(lines...)
+}
@@ -0,0 +1,141 @@
+package gloo
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/solo-io/valet/pkg/step/kubectl"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	DefaultLicenseEnvVar = "LICENSE_KEY"
+	// Secrets holding a license must store it under this key, so that it can be read
+	// with a go-template that contains no spaces (valet splits cmd values on spaces).
+	LicenseSecretKey = "license_key"
+	// Selects the license source for DefaultLicense, e.g. file:license.txt or secret:gloo-system/license.
+	// When unset, the license is read from DefaultLicenseEnvVar.
+	LicenseSourceEnvVar = "LICENSE_SOURCE"
+	// Where the license preflight stores the key read from LICENSE_SOURCE, relative to the workflow directory.
+	DefaultLicenseFile = "_output/license-key"
+)
+
+// A LicenseSource describes where the Gloo Enterprise license key comes from.
+// It is rendered as a valet value when installing the chart, and as a shell
+// expression when running the license preflight.
+type LicenseSource struct {
+	description string
+	value       string
+	shell       string
+	// Lines the preflight runs before reading the key with shell.
+	prelude []string
+	// If set, the preflight stores the key in this file, for the value to read.
+	keyFile string
+}
+
+func LicenseFromEnv(envVar string) LicenseSource {
+	return LicenseSource{
+		description: fmt.Sprintf("environment variable %s", envVar),
+		value:       "env:" + envVar,
+		shell:       fmt.Sprintf("printenv %s", envVar),
+	}
+}
+
+// LicenseFromFile reads the license key from a file, without the trailing newline editors add. The path is
+// relative to the workflow directory, and can't contain spaces (valet splits cmd values on spaces).
+func LicenseFromFile(path string) LicenseSource {
+	return LicenseSource{
+		description: fmt.Sprintf("file %s", path),
+		// valet's file: values keep the trailing newline, which helm would put in the key, so awk joins the lines
+		value: fmt.Sprintf("cmd:awk -vORS= NF %s", path),
+		shell: fmt.Sprintf("cat %s", path),
+	}
+}
+
+var licenseSecretTemplate = fmt.Sprintf("go-template={{.data.%s|base64decode}}", LicenseSecretKey)
+
+func LicenseFromSecret(namespace, name string) LicenseSource {
+	return LicenseSource{
+		description: fmt.Sprintf("secret %s.%s", namespace, name),
+		value:       fmt.Sprintf("cmd:kubectl get secret %s -n %s -o %s", name, namespace, licenseSecretTemplate),
+		shell:       fmt.Sprintf("kubectl get secret %s -n %s -o '%s'", name, namespace, licenseSecretTemplate),
+	}
+}
+
+// DefaultLicense is the license source selected by LICENSE_SOURCE, or the LICENSE_KEY environment variable. The source
+// is selected when the workflow runs, rather than when it is built, so that the serialized workflow doesn't depend on
+// the environment it was generated in. CheckLicense(DefaultLicense()) reads the key and stores it in
+// DefaultLicenseFile, so it has to run before the key is used, i.e. before installing the chart.
+func DefaultLicense() LicenseSource {
+	return LicenseSource{
+		description: "$source",
+		value:       "file:" + DefaultLicenseFile,
+		prelude: []string{
+			fmt.Sprintf(`source="${%s:-env:%s}"`, LicenseSourceEnvVar, DefaultLicenseEnvVar),
+			fmt.Sprintf(`case "$source" in env:?*|file:?*|secret:?*/?*) ;; *) echo "Invalid %s $source, expected env:VAR, file:PATH or secret:NAMESPACE/NAME"; exit 1 ;; esac`,
+				LicenseSourceEnvVar),
+			"read_license() {",
+			`  case "$source" in`,
+			`    env:*) printenv "${source#env:}" ;;`,
+			`    file:*) cat "${source#file:}" ;;`,
+			`    secret:*) secret="${source#secret:}"; kubectl get secret "${secret#*/}" -n "${secret%%/*}" -o '` + licenseSecretTemplate + `' ;;`,
+			"  esac",
+			"}",
+		},
+		shell:   "read_license",
+		keyFile: DefaultLicenseFile,
+	}
+}
+
+// The valet value used for the license_key helm value.
+func (l LicenseSource) Value() string {
+	return l.value
+}
+
+// CheckLicense fails fast if the license key can't be found, isn't a well-formed JWT,
+// has expired, or (when tiers are provided) has a license type ("lt" claim) that isn't allowed.
+func CheckLicense(license LicenseSource, tiers ...string) *workflow.Step {
+	lines := append([]string{}, license.prelude...)
+	lines = append(lines,
+		fmt.Sprintf(`key="$(%s 2>/dev/null || true)"`, license.shell),
+		fmt.Sprintf(`[ -n "$key" ] || { echo "Gloo Enterprise license key not found in %s"; exit 1; }`, license.description),
+		`payload="$(echo "$key" | cut -d. -f2 | tr '_-' '/+')"`,
+		`case $(( ${#payload} % 4 )) in 2) payload="$payload==" ;; 3) payload="$payload=" ;; esac`,
+		`claims="$(echo "$payload" | base64 -d 2>/dev/null || true)"`,
+		`exp="$(echo "$claims" | sed -n 's/.*"exp": *\([0-9]*\).*/\1/p')"`,
+		`tier="$(echo "$claims" | sed -n 's/.*"lt": *"\([^"]*\)".*/\1/p')"`,
+		`[ -n "$exp" ] || { echo "Gloo Enterprise license key could not be decoded"; exit 1; }`,
+		`[ "$exp" -gt "$(date +%s)" ] || { echo "Gloo Enterprise license key expired at unix time $exp"; exit 1; }`)
+	if len(tiers) > 0 {
+		lines = append(lines,
+			fmt.Sprintf(`case "$tier" in %s) ;; *) echo "Gloo Enterprise license type '$tier' is not one of: %s"; exit 1 ;; esac`,
+				strings.Join(tiers, "|"), strings.Join(tiers, ", ")))
+	}
+	if license.keyFile != "" {
+		lines = append(lines,
+			fmt.Sprintf(`mkdir -p %s && (umask 077 && printf '%%s' "$key" > %s)`, filepath.Dir(license.keyFile), license.keyFile))
+	}
+	lines = append(lines, `echo "Gloo Enterprise license ok (type: ${tier:-unknown}, expires at unix time $exp)"`)
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// CreateLicenseSecret stores the license key from an environment variable in a secret
+// that can be used with LicenseFromSecret.
+func CreateLicenseSecret(namespace, name, envVar string) *workflow.Step {
+	return &workflow.Step{
+		CreateSecret: &kubectl.CreateSecret{
+			Namespace: namespace,
+			Name:      name,
+			Type:      "generic",
+			Entries: map[string]kubectl.SecretValue{
+				LicenseSecretKey: {EnvVar: envVar},
+			},
+		},
+	}
+}
@@ -0,0 +1,191 @@
+package gloo_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/cmd"
+	"github.com/solo-io/valet/pkg/render"
+)
+
+// A license key with the claims CheckLicense decodes. The signature isn't checked.
+func licenseKey(expiresAt time.Time) string {
+	claims := fmt.Sprintf(`{"exp":%d,"lt":"enterprise"}`, expiresAt.Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+var _ = Describe("License sources", func() {
+	var (
+		dir  string
+		path string
+		key  string
+	)
+
+	// Renders the source as valet does for the license_key helm value.
+	value := func(license gloo.LicenseSource) string {
+		rendered, err := render.Values{"license_key": license.Value()}.GetValue("license_key", cmd.DefaultCommandRunner())
+		Expect(err).To(BeNil())
+		return rendered
+	}
+
+	checkLicense := func(license gloo.LicenseSource) (string, error) {
+		check := exec.Command("bash", "-c", gloo.CheckLicense(license, "enterprise").Bash.Inline)
+		check.Dir = dir
+		out, err := check.CombinedOutput()
+		return string(out), err
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "license-")
+		Expect(err).To(BeNil())
+		path = os.Getenv("PATH")
+		key = licenseKey(time.Now().Add(time.Hour))
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	})
+
+	Context("from a file", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "license.txt"), []byte(key+"\n"), 0644)).To(BeNil())
+		})
+
+		It("renders the key without the trailing newline", func() {
+			Expect(value(gloo.LicenseFromFile(filepath.Join(dir, "license.txt")))).To(Equal(key))
+		})
+
+		It("passes the license check", func() {
+			out, err := checkLicense(gloo.LicenseFromFile("license.txt"))
+			Expect(err).To(BeNil(), out)
+			Expect(out).To(ContainSubstring("Gloo Enterprise license ok (type: enterprise"))
+		})
+
+		It("fails the license check when the file is missing", func() {
+			out, err := checkLicense(gloo.LicenseFromFile("missing.txt"))
+			Expect(err).NotTo(BeNil())
+			Expect(out).To(ContainSubstring("Gloo Enterprise license key not found in file missing.txt"))
+		})
+	})
+
+	Context("from a secret", func() {
+		BeforeEach(func() {
+			// Serves the key only for the exact command that reads the secret, like kubectl would for the template.
+			fake := fmt.Sprintf(`#!/bin/bash
+if [ "$*" == 'get secret license -n gloo-system -o go-template={{.data.license_key|base64decode}}' ]; then
+  printf '%%s' '%s'
+  exit 0
+fi
+echo "unexpected kubectl $*" >&2
+exit 1
+`, key)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(fake), 0755)).To(BeNil())
+			os.Setenv("PATH", fmt.Sprintf("%s:%s", dir, path))
+		})
+
+		It("renders the key", func() {
+			Expect(value(gloo.LicenseFromSecret("gloo-system", "license"))).To(Equal(key))
+		})
+
+		It("passes the license check", func() {
+			out, err := checkLicense(gloo.LicenseFromSecret("gloo-system", "license"))
+			Expect(err).To(BeNil(), out)
+			Expect(out).To(ContainSubstring("Gloo Enterprise license ok (type: enterprise"))
+		})
+
+		It("fails the license check when the secret doesn't exist", func() {
+			out, err := checkLicense(gloo.LicenseFromSecret("gloo-system", "other"))
+			Expect(err).NotTo(BeNil())
+			Expect(out).To(ContainSubstring("Gloo Enterprise license key not found in secret gloo-system.other"))
+		})
+	})
+
+	Context("selected with LICENSE_SOURCE", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "license.txt"), []byte(key+"\n"), 0644)).To(BeNil())
+			// Serves the key only for the exact command that reads the secret, like kubectl would for the template.
+			fake := fmt.Sprintf(`#!/bin/bash
+if [ "$*" == 'get secret license -n gloo-system -o go-template={{.data.license_key|base64decode}}' ]; then
+  printf '%%s' '%s'
+  exit 0
+fi
+exit 1
+`, key)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(fake), 0755)).To(BeNil())
+			os.Setenv("PATH", fmt.Sprintf("%s:%s", dir, path))
+		})
+
+		AfterEach(func() {
+			os.Unsetenv(gloo.LicenseSourceEnvVar)
+			os.Unsetenv(gloo.DefaultLicenseEnvVar)
+			os.Unsetenv("GLOO_LICENSE")
+		})
+
+		// Renders the license value from the workflow directory, as valet does.
+		valueInDir := func(license gloo.LicenseSource) string {
+			wd, err := os.Getwd()
+			Expect(err).To(BeNil())
+			Expect(os.Chdir(dir)).To(BeNil())
+			defer os.Chdir(wd)
+			return value(license)
+		}
+
+		table.DescribeTable("reads the key when the workflow runs, and stores it for the install",
+			func(source string) {
+				os.Setenv("GLOO_LICENSE", key)
+				if source != "" {
+					os.Setenv(gloo.LicenseSourceEnvVar, source)
+				} else {
+					os.Setenv(gloo.DefaultLicenseEnvVar, key)
+				}
+				out, err := checkLicense(gloo.DefaultLicense())
+				Expect(err).To(BeNil(), out)
+				Expect(out).To(ContainSubstring("Gloo Enterprise license ok (type: enterprise"))
+				Expect(valueInDir(gloo.DefaultLicense())).To(Equal(key))
+			},
+			table.Entry("LICENSE_KEY by default", ""),
+			table.Entry("env", "env:GLOO_LICENSE"),
+			table.Entry("file", "file:license.txt"),
+			table.Entry("secret", "secret:gloo-system/license"),
+		)
+
+		table.DescribeTable("rejects invalid sources",
+			func(source string) {
+				os.Setenv(gloo.LicenseSourceEnvVar, source)
+				out, err := checkLicense(gloo.DefaultLicense())
+				Expect(err).NotTo(BeNil())
+				Expect(out).To(Equal(fmt.Sprintf("Invalid LICENSE_SOURCE %s, expected env:VAR, file:PATH or secret:NAMESPACE/NAME\n", source)))
+			},
+			table.Entry("no kind", "license.txt"),
+			table.Entry("unknown kind", "vault:license"),
+			table.Entry("empty", "file:"),
+			table.Entry("secret without namespace", "secret:license"),
+		)
+
+		It("fails the license check when the selected source has no key", func() {
+			os.Setenv(gloo.LicenseSourceEnvVar, "secret:gloo-system/other")
+			out, err := checkLicense(gloo.DefaultLicense())
+			Expect(err).NotTo(BeNil())
+			Expect(out).To(ContainSubstring("Gloo Enterprise license key not found in secret:gloo-system/other"))
+			Expect(filepath.Join(dir, gloo.DefaultLicenseFile)).NotTo(BeAnExistingFile())
+		})
+
+		It("doesn't depend on LICENSE_SOURCE when the workflow is built", func() {
+			unset := gloo.CheckLicense(gloo.DefaultLicense())
+			os.Setenv(gloo.LicenseSourceEnvVar, "secret:gloo-system/license")
+			Expect(gloo.CheckLicense(gloo.DefaultLicense())).To(Equal(unset))
+			Expect(gloo.DefaultLicense().Value()).To(Equal("file:" + gloo.DefaultLicenseFile))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package gloo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	errors "github.com/rotisserie/eris"
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+// Previous log levels are stored locally, relative to the workflow directory.
+const logLevelDir = "_output/log-levels"
+
+// A LoggingComponent is a deployment in gloo-system whose log level can be changed at runtime.
+// Gloo components serve the zap level handler on /logging; Envoy serves its admin /logging endpoint.
+type LoggingComponent struct {
+	Deployment string
+	Port       int
+	Envoy      bool
+}
+
+var (
+	GlooLogging         = LoggingComponent{Deployment: "gloo", Port: 9091}
+	GatewayLogging      = LoggingComponent{Deployment: "gateway", Port: 9091}
+	DiscoveryLogging    = LoggingComponent{Deployment: "discovery", Port: 9091}
+	ExtauthLogging      = LoggingComponent{Deployment: "extauth", Port: 9091}
+	RateLimitLogging    = LoggingComponent{Deployment: "rate-limit", Port: 9091}
+	GatewayProxyLogging = LoggingComponent{Deployment: "gateway-proxy", Port: 19000, Envoy: true}
+
+	LoggingComponents = []LoggingComponent{
+		GlooLogging, GatewayLogging, DiscoveryLogging, ExtauthLogging, RateLimitLogging, GatewayProxyLogging,
+	}
+
+	RestoreLogLevelError = func(deployment, output string) error {
+		return errors.Errorf("Failed to restore the %s log level:\n%s", deployment, output)
+	}
+)
+
+func (c LoggingComponent) url() string {
+	return fmt.Sprintf("localhost:%d/logging", c.Port)
+}
+
+func (c LoggingComponent) levelFile() string {
+	return fmt.Sprintf("%s/%s", logLevelDir, c.Deployment)
+}
+
+// Lines that port-forward to a deployment in gloo-system for the rest of the script,
+// and wait until the path responds.
+func portForwardLines(deployment string, port int, path string) []string {
+	portForward := bash.PortForward{Namespace: "gloo-system", Resource: "deploy/" + deployment, Port: port, LocalPort: port}
+	return append(bash.PortForwardLines(portForward),
+		fmt.Sprintf("for i in $(seq 30); do curl -s -o /dev/null localhost:%d%s && break; sleep 1; done", port, path))
+}
+
+// SetLogLevel sets the log level of a component. The level it had before the first change
+// is saved, so that RestoreLogLevel can put it back at the end of the workflow, and RestoreLogLevels
+// after the workflow if it fails first.
+func SetLogLevel(component LoggingComponent, level string) *workflow.Step {
+	lines := []string{"set -e", fmt.Sprintf("mkdir -p %s", logLevelDir)}
+	lines = append(lines, portForwardLines(component.Deployment, component.Port, "/logging")...)
+	if component.Envoy {
+		lines = append(lines,
+			// Without query parameters, Envoy lists the active loggers as "name: level".
+			fmt.Sprintf(`[ -f %s ] || curl -s -X POST %s | sed -n 's/^ *\([a-z0-9_]*\): \([a-z]*\)$/\1=\2/p' > %s`,
+				component.levelFile(), component.url(), component.levelFile()),
+			fmt.Sprintf(`curl -sf -o /dev/null -X POST "%s?level=%s"`, component.url(), level))
+	} else {
+		lines = append(lines,
+			fmt.Sprintf(`[ -f %s ] || curl -sf %s | sed -n 's/.*"level": *"\([a-z]*\)".*/\1/p' > %s`,
+				component.levelFile(), component.url(), component.levelFile()),
+			fmt.Sprintf(`curl -sf -o /dev/null -X PUT -d '{"level":"%s"}' %s`, level, component.url()))
+	}
+	lines = append(lines, fmt.Sprintf(`echo "Set %s log level to %s (previously $(tr '\n' ' ' < %s))"`,
+		component.Deployment, level, component.levelFile()))
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// RestoreLogLevel puts back the log level a component had before SetLogLevel was first used.
+func RestoreLogLevel(component LoggingComponent) *workflow.Step {
+	lines := []string{
+		"set -e",
+		fmt.Sprintf(`[ -f %s ] || { echo "No saved log level for %s"; exit 0; }`, component.levelFile(), component.Deployment),
+	}
+	lines = append(lines, portForwardLines(component.Deployment, component.Port, "/logging")...)
+	if component.Envoy {
+		lines = append(lines, fmt.Sprintf(`while read -r logger; do curl -sf -o /dev/null -X POST "%s?$logger"; done < %s`,
+			component.url(), component.levelFile()))
+	} else {
+		lines = append(lines, fmt.Sprintf(`curl -sf -o /dev/null -X PUT -d "{\"level\":\"$(cat %s)\"}" %s`,
+			component.levelFile(), component.url()))
+	}
+	lines = append(lines,
+		fmt.Sprintf("rm %s", component.levelFile()),
+		fmt.Sprintf(`echo "Restored %s log level"`, component.Deployment))
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// RestoreLogLevels puts back every log level that SetLogLevel saved in the workflow directory and that no
+// RestoreLogLevel step has put back yet. It is meant to run after the workflow, e.g. from an AfterSuite, so that
+// the levels are restored even when the workflow fails before its RestoreLogLevel steps.
+func RestoreLogLevels(dir string) error {
+	for _, component := range LoggingComponents {
+		if _, err := os.Stat(filepath.Join(dir, component.levelFile())); os.IsNotExist(err) {
+			continue
+		}
+		cmd := exec.Command("bash", "-c", RestoreLogLevel(component).Bash.Inline)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		fmt.Print(string(out))
+		if err != nil {
+			return RestoreLogLevelError(component.Deployment, string(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package gloo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// Enough requests that each side of a 50/50 split is all but certain to show up.
+	responsesSampleSize = 40
+	responsesAttempts   = 30
+)
+
+// CurlResponses waits until a sample of requests to the path gets exactly the given bodies: every response is one of
+// them, and each of them is seen at least once. With one body it checks that all traffic goes to one destination,
+// and with several that traffic is split between them, e.g. by the weights on a route.
+func CurlResponses(path string, headers map[string]string, bodies ...string) *workflow.Step {
+	var headerArgs, headerNames, headerLines []string
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	for _, name := range headerNames {
+		headerArgs = append(headerArgs, fmt.Sprintf("-H '%s: %s'", name, headers[name]))
+		headerLines = append(headerLines, fmt.Sprintf("%s: %s", name, headers[name]))
+	}
+	var expected []string
+	for _, body := range bodies {
+		expected = append(expected, fmt.Sprintf("'%s'", body))
+	}
+	description := fmt.Sprintf("%s responded with %s", path, strings.Join(bodies, " and "))
+	if len(headers) > 0 {
+		description += fmt.Sprintf(" with headers %s", strings.Join(headerLines, ", "))
+	}
+	curlCommand := strings.Join(append(append([]string{"curl -sS"}, headerArgs...), fmt.Sprintf("http://localhost:%d%s", httpPort, path)), " ")
+	lines := append(bash.PortForwardLines(bash.GatewayProxy(httpPort, httpPort)),
+		fmt.Sprintf("expected=(%s)", strings.Join(expected, " ")))
+	lines = append(lines, bash.RetryLines(responsesAttempts, 1, []string{
+		`responses=""`,
+		fmt.Sprintf("for j in $(seq %d); do", responsesSampleSize),
+		fmt.Sprintf(`  responses+="$(%s 2>&1 | tr -d '\r')"$'\n'`, curlCommand),
+		"done",
+		"ok=true",
+		`for body in "${expected[@]}"; do`,
+		`  echo "$responses" | grep -qxF "$body" || ok=false`,
+		"done",
+		`unexpected="$(echo "$responses" | grep -v '^$' | grep -vxF "$(printf '%s\n' "${expected[@]}")")"`,
+		`[ -n "$unexpected" ] && ok=false`,
+		fmt.Sprintf("if $ok; then echo %s; exit 0; fi", bash.Quote(description)),
+	}, description,
+		"echo 'Last responses:'",
+		`echo "$responses" | grep -v '^$' | sort | uniq -c`)...)
+	return bash.Step(lines...)
+}
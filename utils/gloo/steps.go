@@ -2,6 +2,7 @@ package gloo
 
 import (
 	"fmt"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/step/helm"
 	"github.com/solo-io/valet/pkg/step/kubectl"
@@ -41,25 +42,70 @@ func GlooctlCheck() *workflow.Step {
 
 
 func InstallGloo() *workflow.Step {
+	return InstallGlooVersion("1.3.17")
+}
+
+// InstallGlooVersion installs an open source release other than the default, for workflows that depend on its features.
+func InstallGlooVersion(version string, valuesFiles ...string) *workflow.Step {
 	return &workflow.Step{
 		InstallHelmChart: &helm.InstallHelmChart{
 			ReleaseName: "gloo",
-			ReleaseUri:  "https://storage.googleapis.com/solo-public-helm/charts/gloo-1.3.17.tgz",
+			ReleaseUri:  cluster.Chart(fmt.Sprintf("https://storage.googleapis.com/solo-public-helm/charts/gloo-%s.tgz", version)),
 			Namespace:   "gloo-system",
+			ValuesFiles: valuesFiles,
 			WaitForPods: true,
 		},
 	}
 }
 
+// UninstallOtherGlooVersions removes the gloo release if it was installed from a different chart, e.g. "gloo-1.4.5",
+// or without any of the deployments, e.g. ones that the workflow's values file enables. An existing release is
+// otherwise kept as-is by the install steps, so a workflow would run against the wrong version or values.
+func UninstallOtherGlooVersions(chart string, deployments ...string) *workflow.Step {
+	lines := []string{
+		"set -e",
+		`installed="$(helm list -n gloo-system --filter '^gloo$' -o yaml | sed -n 's/^ *chart: //p')"`,
+		`if [ -z "$installed" ]; then exit 0; fi`,
+	}
+	keep := fmt.Sprintf(`[ "$installed" == "%s" ]`, chart)
+	if len(deployments) > 0 {
+		lines = append(lines,
+			"missing=()",
+			fmt.Sprintf(`for deployment in %s; do kubectl get deploy -n gloo-system "$deployment" >/dev/null 2>&1 || missing+=("$deployment"); done`,
+				strings.Join(deployments, " ")),
+			`if [ ${#missing[@]} -gt 0 ]; then echo "$installed doesn't have the deployments ${missing[*]}"; fi`)
+		keep += " && [ ${#missing[@]} -eq 0 ]"
+	}
+	lines = append(lines,
+		fmt.Sprintf("if %s; then exit 0; fi", keep),
+		fmt.Sprintf(`echo "Uninstalling $installed, to replace it with %s"`, chart),
+		"helm uninstall gloo -n gloo-system",
+		"kubectl delete namespace gloo-system --wait")
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: strings.Join(lines, "\n"),
+		},
+	}
+}
+
 func InstallGlooEnterprise() *workflow.Step {
+	return InstallGlooEnterpriseWithLicense(DefaultLicense())
+}
+
+func InstallGlooEnterpriseWithLicense(license LicenseSource) *workflow.Step {
+	return InstallGlooEnterpriseVersion("1.3.2", license)
+}
+
+// InstallGlooEnterpriseVersion installs an enterprise release other than the default, for workflows that depend on its features.
+func InstallGlooEnterpriseVersion(version string, license LicenseSource) *workflow.Step {
 	return &workflow.Step{
 		InstallHelmChart: &helm.InstallHelmChart{
 			ReleaseName: "gloo",
-			ReleaseUri:  "https://storage.googleapis.com/gloo-ee-helm/charts/gloo-ee-1.3.2.tgz",
+			ReleaseUri:  cluster.Chart(fmt.Sprintf("https://storage.googleapis.com/gloo-ee-helm/charts/gloo-ee-%s.tgz", version)),
 			Namespace:   "gloo-system",
 			WaitForPods: true,
 			Set: map[string]string{
-				"license_key": "env:LICENSE_KEY",
+				"license_key": license.Value(),
 			},
 		},
 	}
@@ -83,6 +129,30 @@ func PatchSettings(path string) *workflow.Step {
 	}
 }
 
+func PatchGateway(path string) *workflow.Step {
+	return &workflow.Step{
+		Patch: &kubectl.Patch{
+			Name:      "gateway-proxy",
+			Namespace: "gloo-system",
+			KubeType:  "gateway",
+			PatchType: "merge",
+			Path:      path,
+		},
+	}
+}
+
+func PatchGatewayProxyService(path string) *workflow.Step {
+	return &workflow.Step{
+		Patch: &kubectl.Patch{
+			Name:      "gateway-proxy",
+			Namespace: "gloo-system",
+			KubeType:  "service",
+			PatchType: "merge",
+			Path:      path,
+		},
+	}
+}
+
 func DeleteAllVirtualServices() *workflow.Step {
 	return &workflow.Step{
 		Bash: &script.Bash{
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+)
+
+type resolveFlags map[string]string
+
+func (r resolveFlags) String() string {
+	return fmt.Sprint(map[string]string(r))
+}
+
+func (r resolveFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected HOST:PORT=ADDRESS, got %s", value)
+	}
+	r[parts[0]] = parts[1]
+	return nil
+}
+
+// Drives an authorization code login through an app and its identity provider, and checks where it ends up.
+// Exits non-zero if the login fails, or doesn't end as expected, printing every hop it made.
+func main() {
+	flow := login.Flow{Resolve: resolveFlags{}}
+	flag.StringVar(&flow.StartUrl, "url", "", "app URL to start the login at")
+	flag.StringVar(&flow.Username, "username", "", "username to submit to the login form")
+	flag.StringVar(&flow.Password, "password", "", "password to submit to the login form")
+	flag.StringVar(&flow.UsernameField, "username-field", login.DefaultUsernameField, "name of the login form's username field")
+	flag.StringVar(&flow.PasswordField, "password-field", login.DefaultPasswordField, "name of the login form's password field")
+	flag.Var(resolveFlags(flow.Resolve), "resolve", "HOST:PORT=ADDRESS to dial instead of HOST:PORT, may be repeated")
+	statusCode := flag.Int("status", 200, "expected status code of the final response")
+	bodySubstring := flag.String("body-substring", "", "expected substring of the final response body")
+	sessionCookie := flag.String("session-cookie", "", "cookie the app is expected to set, e.g. "+login.GlooSessionCookie)
+	callbackPath := flag.String("callback-path", "", "path on the app the identity provider is expected to redirect back to")
+	flag.Parse()
+
+	result, err := flow.Run()
+	if err == nil {
+		err = check(flow, result, *statusCode, *bodySubstring, *sessionCookie, *callbackPath)
+	}
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println(result.Report())
+		if result.Body != "" {
+			fmt.Printf("Final response body:\n%s\n", result.Body)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Login as %s ended at %s with status %d after %d hops\n", flow.Username, result.Url, result.StatusCode, len(result.Hops))
+}
+
+func check(flow login.Flow, result *login.Result, statusCode int, bodySubstring, sessionCookie, callbackPath string) error {
+	if result.StatusCode != statusCode {
+		return fmt.Errorf("Login ended at %s with status %d, expected %d", result.Url, result.StatusCode, statusCode)
+	}
+	if !strings.Contains(result.Body, bodySubstring) {
+		return fmt.Errorf("Login ended at %s with a body not containing %q", result.Url, bodySubstring)
+	}
+	if callbackPath != "" && !result.VisitedPath(flow.StartUrl, callbackPath) {
+		return fmt.Errorf("Login never returned to the app at %s", callbackPath)
+	}
+	if sessionCookie != "" && result.Cookie(sessionCookie) == nil {
+		return fmt.Errorf("Login ended without the app setting the %s cookie", sessionCookie)
+	}
+	return nil
+}
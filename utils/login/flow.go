@@ -0,0 +1,340 @@
+package login
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	errors "github.com/rotisserie/eris"
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultUsernameField = "username"
+	DefaultPasswordField = "password"
+	DefaultMaxHops       = 20
+
+	// Gloo's oauth config keeps the user's session in this cookie after the callback.
+	GlooSessionCookie = "id_token"
+
+	requestTimeout = 30 * time.Second
+)
+
+var (
+	NoLoginFormError = func(url string) error {
+		return errors.Errorf("Login ended at %s without reaching a login form", url)
+	}
+	CredentialsRejectedError = func(url string) error {
+		return errors.Errorf("Login form at %s was shown again after submitting the credentials", url)
+	}
+	TooManyHopsError = func(maxHops int) error {
+		return errors.Errorf("Login didn't finish within %d requests", maxHops)
+	}
+)
+
+// A Flow drives an authorization code login the way a browser would: starting at the app, it follows redirects to
+// the identity provider, submits the credentials to its login form, and follows the redirects back to the app,
+// keeping cookies along the way.
+type Flow struct {
+	StartUrl string
+	Username string
+	Password string
+
+	// Names of the login form fields, defaulting to username and password.
+	UsernameField string
+	PasswordField string
+
+	// Addresses to dial instead of a host:port, like curl's --resolve. The URLs, Host headers and cookies keep
+	// using the original host, so in-cluster hostnames can be reached through port-forwards.
+	Resolve map[string]string
+
+	MaxHops int
+}
+
+// The last response the flow got, and how it got there.
+type Result struct {
+	Url        string
+	StatusCode int
+	Body       string
+	Hops       []Hop
+	// Cookies the client would send back to the start URL, e.g. the session cookie.
+	Cookies []*http.Cookie
+}
+
+// A Hop is one request the flow made, and where it was sent next.
+type Hop struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Location   string
+	SetCookies []string
+	LoginForm  bool
+}
+
+func (h Hop) String() string {
+	s := fmt.Sprintf("%s %s -> %d", h.Method, h.Url, h.StatusCode)
+	if h.Location != "" {
+		s += " Location: " + h.Location
+	}
+	if len(h.SetCookies) > 0 {
+		s += " Set-Cookie: " + strings.Join(h.SetCookies, ", ")
+	}
+	if h.LoginForm {
+		s += " (login form)"
+	}
+	return s
+}
+
+// Cookie returns the named cookie sent back to the start URL, or nil if it wasn't set.
+func (r *Result) Cookie(name string) *http.Cookie {
+	for _, cookie := range r.Cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// VisitedPath reports whether a request was made to the path on the start URL's host, e.g. the oauth callback.
+func (r *Result) VisitedPath(startUrl, path string) bool {
+	start, err := url.Parse(startUrl)
+	if err != nil {
+		return false
+	}
+	for _, hop := range r.Hops {
+		u, err := url.Parse(hop.Url)
+		if err == nil && u.Host == start.Host && u.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Report describes every hop, for when the flow doesn't end as expected.
+func (r *Result) Report() string {
+	lines := []string{fmt.Sprintf("Hops (%d):", len(r.Hops))}
+	for i, hop := range r.Hops {
+		lines = append(lines, fmt.Sprintf("  %d. %s", i+1, hop))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type loginForm struct {
+	action string
+	method string
+	fields url.Values
+}
+
+// Run drives the login. The result records the hops made so far even if it fails, so they can be reported.
+func (f *Flow) Run() (*Result, error) {
+	result := &Result{}
+	client, err := f.client()
+	if err != nil {
+		return result, err
+	}
+	req, err := http.NewRequest(http.MethodGet, f.StartUrl, nil)
+	if err != nil {
+		return result, err
+	}
+	submitted := false
+	for hop := 0; hop < f.maxHops(); hop++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			return result, errors.Wrapf(err, "requesting %s", req.URL)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return result, errors.Wrapf(err, "reading response from %s", req.URL)
+		}
+		result.Hops = append(result.Hops, Hop{
+			Method:     req.Method,
+			Url:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Location:   resp.Header.Get("Location"),
+			SetCookies: cookieNames(resp),
+		})
+		last := &result.Hops[len(result.Hops)-1]
+		result.Url = req.URL.String()
+		result.StatusCode = resp.StatusCode
+		result.Body = string(body)
+
+		if isRedirect(resp.StatusCode) {
+			location, err := resp.Location()
+			if err != nil {
+				return result, errors.Wrapf(err, "following redirect from %s", req.URL)
+			}
+			if req, err = http.NewRequest(http.MethodGet, location.String(), nil); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		form, err := findLoginForm(body, f.passwordField())
+		if err != nil {
+			return result, errors.Wrapf(err, "parsing response from %s", req.URL)
+		}
+		if form == nil {
+			if !submitted {
+				return result, NoLoginFormError(req.URL.String())
+			}
+			if start, err := url.Parse(f.StartUrl); err == nil {
+				result.Cookies = client.Jar.Cookies(start)
+			}
+			return result, nil
+		}
+		last.LoginForm = true
+		if submitted {
+			return result, CredentialsRejectedError(req.URL.String())
+		}
+		if req, err = f.submit(form, req.URL); err != nil {
+			return result, err
+		}
+		submitted = true
+	}
+	return result, TooManyHopsError(f.maxHops())
+}
+
+func (f *Flow) client() (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if resolved, ok := f.Resolve[addr]; ok {
+				addr = resolved
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	return &http.Client{
+		Jar:       jar,
+		Transport: transport,
+		Timeout:   requestTimeout,
+		// Redirects are followed by the flow, so that login forms can be found along the way
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+func (f *Flow) submit(form *loginForm, page *url.URL) (*http.Request, error) {
+	action, err := page.Parse(form.action)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing login form action %s", form.action)
+	}
+	form.fields.Set(f.usernameField(), f.Username)
+	form.fields.Set(f.passwordField(), f.Password)
+	if form.method == http.MethodGet {
+		action.RawQuery = form.fields.Encode()
+		return http.NewRequest(http.MethodGet, action.String(), nil)
+	}
+	req, err := http.NewRequest(http.MethodPost, action.String(), strings.NewReader(form.fields.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+func (f *Flow) usernameField() string {
+	if f.UsernameField == "" {
+		return DefaultUsernameField
+	}
+	return f.UsernameField
+}
+
+func (f *Flow) passwordField() string {
+	if f.PasswordField == "" {
+		return DefaultPasswordField
+	}
+	return f.PasswordField
+}
+
+func (f *Flow) maxHops() int {
+	if f.MaxHops == 0 {
+		return DefaultMaxHops
+	}
+	return f.MaxHops
+}
+
+// The names of the cookies a response sets. Values are left out, since they're usually tokens.
+func cookieNames(resp *http.Response) []string {
+	var names []string
+	for _, cookie := range resp.Cookies() {
+		names = append(names, cookie.Name)
+	}
+	return names
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// findLoginForm returns the first form in the page with the password field, along with the values of its other
+// fields (such as hidden session codes), or nil if there isn't one.
+func findLoginForm(page []byte, passwordField string) (*loginForm, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	var found *loginForm
+	var visit func(n *html.Node, form *loginForm, hasPassword *bool)
+	visit = func(n *html.Node, form *loginForm, hasPassword *bool) {
+		if found != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "form" && form == nil {
+			form = &loginForm{
+				action: attr(n, "action"),
+				method: strings.ToUpper(attr(n, "method")),
+				fields: url.Values{},
+			}
+			hasPassword = new(bool)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				visit(c, form, hasPassword)
+			}
+			if *hasPassword && found == nil {
+				found = form
+			}
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "input" && form != nil {
+			name := attr(n, "name")
+			if name == passwordField {
+				*hasPassword = true
+			}
+			if name != "" && !strings.EqualFold(attr(n, "type"), "submit") {
+				form.fields.Set(name, attr(n, "value"))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c, form, hasPassword)
+		}
+	}
+	visit(doc, nil, nil)
+	return found, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
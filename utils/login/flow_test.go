@@ -0,0 +1,149 @@
+package login_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+)
+
+func TestLogin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Login Flow Suite")
+}
+
+const (
+	appHost = "app.example.com:80"
+	idpHost = "idp.example.com:8080"
+)
+
+// An app that redirects to the identity provider until it has a session, like Gloo's oauth extauth config.
+func appHandler(username string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/callback":
+			if r.URL.Query().Get("code") != "code-for-"+username {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: username, Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			if cookie, err := r.Cookie("session"); err == nil {
+				fmt.Fprintf(w, "Welcome %s", cookie.Value)
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("http://%s/auth?redirect_uri=http://%s/callback", idpHost, appHost), http.StatusFound)
+		}
+	}
+}
+
+// An identity provider with a login form that needs a hidden session code, and its own cookie.
+func idpHandler(username, password string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth":
+			http.SetCookie(w, &http.Cookie{Name: "idp-session", Value: "abc", Path: "/"})
+			fmt.Fprintf(w, `<html><body>
+<form id="login" action="/authenticate?session_code=abc&amp;redirect_uri=%s" method="post">
+  <input type="hidden" name="tab_id" value="tab">
+  <input type="text" name="username">
+  <input type="password" name="password">
+  <input type="submit" name="login" value="Sign In">
+</form></body></html>`, r.URL.Query().Get("redirect_uri"))
+		case "/authenticate":
+			_ = r.ParseForm()
+			cookie, err := r.Cookie("idp-session")
+			if err != nil || cookie.Value != "abc" || r.URL.Query().Get("session_code") != "abc" || r.PostForm.Get("tab_id") != "tab" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.PostForm.Get("username") != username || r.PostForm.Get("password") != password {
+				http.Redirect(w, r, "/auth?redirect_uri="+r.URL.Query().Get("redirect_uri"), http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code=code-for-"+username, http.StatusFound)
+		}
+	}
+}
+
+var _ = Describe("Login flow", func() {
+	var (
+		app, idp *httptest.Server
+		flow     *login.Flow
+	)
+
+	BeforeEach(func() {
+		app = httptest.NewServer(appHandler("alice"))
+		idp = httptest.NewServer(idpHandler("alice", "secret"))
+		flow = &login.Flow{
+			StartUrl: fmt.Sprintf("http://%s/", appHost),
+			Username: "alice",
+			Password: "secret",
+			Resolve: map[string]string{
+				appHost: strings.TrimPrefix(app.URL, "http://"),
+				idpHost: strings.TrimPrefix(idp.URL, "http://"),
+			},
+		}
+	})
+
+	AfterEach(func() {
+		app.Close()
+		idp.Close()
+	})
+
+	It("logs in through the identity provider and returns to the app", func() {
+		result, err := flow.Run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Url).To(Equal(fmt.Sprintf("http://%s/", appHost)))
+		Expect(result.StatusCode).To(Equal(http.StatusOK))
+		Expect(result.Body).To(Equal("Welcome alice"))
+	})
+
+	It("records every hop, and the cookies set along the way", func() {
+		result, err := flow.Run()
+		Expect(err).NotTo(HaveOccurred())
+		var hops []string
+		for _, hop := range result.Hops {
+			hops = append(hops, fmt.Sprintf("%s %d", hop.Method, hop.StatusCode))
+		}
+		// app, login form, credentials, callback, app
+		Expect(hops).To(Equal([]string{"GET 302", "GET 200", "POST 302", "GET 302", "GET 200"}))
+		Expect(result.Hops[1].LoginForm).To(BeTrue())
+		Expect(result.Hops[1].SetCookies).To(ConsistOf("idp-session"))
+		Expect(result.Hops[3].SetCookies).To(ConsistOf("session"))
+		Expect(result.Cookie("session")).NotTo(BeNil())
+		Expect(result.Cookie("session").Value).To(Equal("alice"))
+		// Cookies for the identity provider aren't sent to the app
+		Expect(result.Cookie("idp-session")).To(BeNil())
+		Expect(result.VisitedPath(flow.StartUrl, "/callback")).To(BeTrue())
+		Expect(result.VisitedPath(flow.StartUrl, "/authenticate")).To(BeFalse())
+		Expect(result.Report()).To(ContainSubstring(fmt.Sprintf("  4. GET http://%s/callback?code=code-for-alice -> 302 Location: / Set-Cookie: session", appHost)))
+	})
+
+	It("fails when the credentials are rejected", func() {
+		flow.Password = "wrong"
+		result, err := flow.Run()
+		Expect(err).To(MatchError(ContainSubstring("was shown again after submitting the credentials")))
+		// The hops are kept for reporting the failure
+		Expect(result.Hops).To(HaveLen(4))
+		Expect(result.Report()).To(ContainSubstring("(login form)"))
+	})
+
+	It("fails when there is no login form", func() {
+		flow.StartUrl = fmt.Sprintf("http://%s/anything", idpHost)
+		_, err := flow.Run()
+		Expect(err).To(MatchError(ContainSubstring("without reaching a login form")))
+	})
+
+	It("fails when the redirects don't end", func() {
+		flow.MaxHops = 2
+		_, err := flow.Run()
+		Expect(err).To(MatchError(ContainSubstring("didn't finish within 2 requests")))
+	})
+})
@@ -0,0 +1,80 @@
+package login
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+var buildLoginCommand, loginCommand = bash.GoCommand("login", "utils/login/cmd")
+
+const (
+	loginAttempts = 20
+	loginDelay    = 3
+)
+
+// A PortForward exposes an in-cluster host on a local port, for the duration of a login step.
+type PortForward struct {
+	// The host:port used in URLs during the login, e.g. keycloak-http.keycloak.svc.cluster.local:8080.
+	Host string
+
+	Namespace string
+	Resource  string
+	Port      int
+	LocalPort int
+}
+
+// A Login is a login flow to run from a workflow, and the response it is expected to end with.
+type Login struct {
+	Url           string
+	Username      string
+	Password      string
+	StatusCode    int
+	BodySubstring string
+	// The cookie the app is expected to set once the user is logged in, e.g. GlooSessionCookie.
+	SessionCookie string
+	// The path on the app the identity provider is expected to redirect back to, e.g. the oauth callback_path.
+	CallbackPath string
+	PortForwards []PortForward
+}
+
+func (l Login) command() string {
+	args := []string{
+		loginCommand,
+		"--url " + bash.Quote(l.Url),
+		"--username " + bash.Quote(l.Username),
+		"--password " + bash.Quote(l.Password),
+		fmt.Sprintf("--status %d", l.StatusCode),
+	}
+	if l.BodySubstring != "" {
+		args = append(args, "--body-substring "+bash.Quote(l.BodySubstring))
+	}
+	if l.SessionCookie != "" {
+		args = append(args, "--session-cookie "+bash.Quote(l.SessionCookie))
+	}
+	if l.CallbackPath != "" {
+		args = append(args, "--callback-path "+bash.Quote(l.CallbackPath))
+	}
+	for _, pf := range l.PortForwards {
+		args = append(args, "--resolve "+bash.Quote(fmt.Sprintf("%s=127.0.0.1:%d", pf.Host, pf.LocalPort)))
+	}
+	return strings.Join(args, " ")
+}
+
+// Step retries the login until it ends with the expected response, e.g. while the identity provider starts up
+// or the auth config is picked up, and prints the last attempt if it never does.
+func (l Login) Step() *workflow.Step {
+	var portForwards []bash.PortForward
+	for _, pf := range l.PortForwards {
+		portForwards = append(portForwards, bash.PortForward{Namespace: pf.Namespace, Resource: pf.Resource, Port: pf.Port, LocalPort: pf.LocalPort})
+	}
+	lines := append([]string{buildLoginCommand + " || exit 1"}, bash.PortForwardLines(portForwards...)...)
+	lines = append(lines, bash.RetryLines(loginAttempts, loginDelay, []string{
+		fmt.Sprintf(`out="$(%s 2>&1)" && { echo "$out"; exit 0; }`, l.command()),
+	}, fmt.Sprintf("the login as %s to end with status %d", l.Username, l.StatusCode),
+		"echo 'Last attempt:'",
+		`echo "$out"`)...)
+	return bash.Step(lines...)
+}
@@ -0,0 +1,47 @@
+package login_test
+
+import (
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+)
+
+var _ = Describe("Login step", func() {
+
+	It("passes the login's arguments to the command as is", func() {
+		step := login.Login{
+			Url:           "http://app.example.com/",
+			Username:      "o'brien",
+			Password:      `it's "secret" $HOME`,
+			StatusCode:    200,
+			SessionCookie: "session",
+			PortForwards: []login.PortForward{
+				{Host: appHost, Namespace: "gloo-system", Resource: "deploy/gateway-proxy", Port: 8080, LocalPort: 18080},
+			},
+		}.Step()
+
+		// Runs the attempt with a command that prints its arguments, in place of the login command
+		_, command := bash.GoCommand("login", "utils/login/cmd")
+		var attempt string
+		for _, line := range strings.Split(step.Bash.Inline, "\n") {
+			if strings.Contains(line, command) {
+				attempt = strings.Replace(line, command, `printf '[%s]\n'`, 1)
+			}
+		}
+		Expect(attempt).NotTo(BeEmpty())
+		out, err := exec.Command("bash", "-c", attempt).CombinedOutput()
+		Expect(err).To(BeNil(), string(out))
+		Expect(string(out)).To(Equal(strings.Join([]string{
+			"[--url]", "[http://app.example.com/]",
+			"[--username]", "[o'brien]",
+			"[--password]", `[it's "secret" $HOME]`,
+			"[--status]", "[200]",
+			"[--session-cookie]", "[session]",
+			"[--resolve]", "[app.example.com:80=127.0.0.1:18080]",
+		}, "\n") + "\n"))
+	})
+})
@@ -0,0 +1,422 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	errors "github.com/rotisserie/eris"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	AuthorizePath = "/authorize"
+	TokenPath     = "/token"
+	UserinfoPath  = "/userinfo"
+	JwksPath      = "/jwks"
+
+	codeLifetime  = time.Minute
+	tokenLifetime = time.Hour
+)
+
+var (
+	NoIssuerError = errors.New("Config has no issuer")
+)
+
+// Config for the provider, usually loaded from a file mounted into the pod.
+type Config struct {
+	// The issuer URL, as the relying parties reach it. The endpoints are served under its path.
+	Issuer  string   `json:"issuer"`
+	Clients []Client `json:"clients"`
+	Users   []User   `json:"users"`
+}
+
+type Client struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+	// Allowed redirect URIs. A trailing * allows any URI with that prefix.
+	RedirectUris []string `json:"redirectUris"`
+}
+
+// A User that can log in, and the claims added to their tokens, e.g. email.
+type User struct {
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	return &config, nil
+}
+
+// A Provider is a minimal OpenID Connect provider for the authorization code flow, standing in for a real
+// identity provider in workflows. It signs ID tokens with a key generated on startup, and keeps codes and
+// access tokens in memory.
+type Provider struct {
+	config   Config
+	basePath string
+	key      *rsa.PrivateKey
+	keyId    string
+
+	lock         sync.Mutex
+	codes        map[string]*grant
+	accessTokens map[string]*grant
+}
+
+// What a code or access token was granted for.
+type grant struct {
+	client      Client
+	user        User
+	redirectUri string
+	nonce       string
+	scope       string
+	expires     time.Time
+}
+
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Issuer == "" {
+		return nil, NoIssuerError
+	}
+	issuer, err := url.Parse(config.Issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing issuer %s", config.Issuer)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	keyHash := sha256.Sum256(key.PublicKey.N.Bytes())
+	return &Provider{
+		config:       config,
+		basePath:     strings.TrimSuffix(issuer.Path, "/"),
+		key:          key,
+		keyId:        base64.RawURLEncoding.EncodeToString(keyHash[:8]),
+		codes:        make(map[string]*grant),
+		accessTokens: make(map[string]*grant),
+	}, nil
+}
+
+// PublicKey is the key ID tokens are signed with.
+func (p *Provider) PublicKey() *rsa.PublicKey {
+	return &p.key.PublicKey
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, p.basePath) {
+	case DiscoveryPath:
+		p.discovery(w)
+	case JwksPath:
+		p.jwks(w)
+	case AuthorizePath:
+		p.authorize(w, r)
+	case TokenPath:
+		p.token(w, r)
+	case UserinfoPath:
+		p.userinfo(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) endpoint(path string) string {
+	return strings.TrimSuffix(p.config.Issuer, "/") + path
+}
+
+func (p *Provider) discovery(w http.ResponseWriter) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.config.Issuer,
+		"authorization_endpoint":                p.endpoint(AuthorizePath),
+		"token_endpoint":                        p.endpoint(TokenPath),
+		"userinfo_endpoint":                     p.endpoint(UserinfoPath),
+		"jwks_uri":                              p.endpoint(JwksPath),
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": p.keyId,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.PublicKey.E)).Bytes()),
+		}},
+	})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<html>
+<body>
+<h1>Mock OIDC provider</h1>
+{{ if .Error }}<p id="error">{{ .Error }}</p>{{ end }}
+<form id="login" action="{{ .Action }}" method="post">
+  <input type="hidden" name="client_id" value="{{ .ClientId }}">
+  <input type="hidden" name="redirect_uri" value="{{ .RedirectUri }}">
+  <input type="hidden" name="response_type" value="code">
+  <input type="hidden" name="scope" value="{{ .Scope }}">
+  <input type="hidden" name="state" value="{{ .State }}">
+  <input type="hidden" name="nonce" value="{{ .Nonce }}">
+  <input type="text" name="username">
+  <input type="password" name="password">
+  <input type="submit" value="Log in">
+</form>
+</body>
+</html>
+`))
+
+// Shows the login form, and redirects back to the client with a code once the user logs in.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	redirectUri := r.Form.Get("redirect_uri")
+	client, ok := p.client(clientId)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown client %s", clientId), http.StatusBadRequest)
+		return
+	}
+	if !client.allowsRedirect(redirectUri) {
+		http.Error(w, fmt.Sprintf("Redirect URI %s isn't allowed for client %s", redirectUri, clientId), http.StatusBadRequest)
+		return
+	}
+	if responseType := r.Form.Get("response_type"); responseType != "code" {
+		http.Error(w, fmt.Sprintf("Unsupported response type %s", responseType), http.StatusBadRequest)
+		return
+	}
+
+	page := map[string]string{
+		"Action":      p.endpoint(AuthorizePath),
+		"ClientId":    clientId,
+		"RedirectUri": redirectUri,
+		"Scope":       r.Form.Get("scope"),
+		"State":       r.Form.Get("state"),
+		"Nonce":       r.Form.Get("nonce"),
+	}
+	if r.Method != http.MethodPost {
+		_ = loginPage.Execute(w, page)
+		return
+	}
+	user, ok := p.user(r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if !ok {
+		page["Error"] = "Invalid username or password"
+		_ = loginPage.Execute(w, page)
+		return
+	}
+
+	code := randomString()
+	p.lock.Lock()
+	p.codes[code] = &grant{
+		client:      client,
+		user:        user,
+		redirectUri: redirectUri,
+		nonce:       r.Form.Get("nonce"),
+		scope:       r.Form.Get("scope"),
+		expires:     time.Now().Add(codeLifetime),
+	}
+	p.lock.Unlock()
+
+	redirect, err := url.Parse(redirectUri)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	if state := r.Form.Get("state"); state != "" {
+		query.Set("state", state)
+	}
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// Exchanges a code for an ID token and an access token. Codes can only be used once.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, tokenError{"invalid_request", err.Error()})
+		return
+	}
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	client, ok := p.client(clientId)
+	if !ok || client.Secret != clientSecret {
+		writeJson(w, http.StatusUnauthorized, tokenError{"invalid_client", "Unknown client or wrong secret"})
+		return
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		writeJson(w, http.StatusBadRequest, tokenError{"unsupported_grant_type", grantType})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.lock.Lock()
+	granted, ok := p.codes[code]
+	delete(p.codes, code)
+	p.lock.Unlock()
+	if !ok || time.Now().After(granted.expires) || granted.client.Id != clientId {
+		writeJson(w, http.StatusBadRequest, tokenError{"invalid_grant", "Unknown, used or expired code"})
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != granted.redirectUri {
+		writeJson(w, http.StatusBadRequest, tokenError{"invalid_grant", "Redirect URI doesn't match the authorization request"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.sign(p.idTokenClaims(granted, now))
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, tokenError{"server_error", err.Error()})
+		return
+	}
+	accessToken := randomString()
+	p.lock.Lock()
+	p.accessTokens[accessToken] = &grant{
+		client:  granted.client,
+		user:    granted.user,
+		scope:   granted.scope,
+		expires: now.Add(tokenLifetime),
+	}
+	p.lock.Unlock()
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"id_token":     idToken,
+		"scope":        granted.scope,
+	})
+}
+
+func (p *Provider) userinfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.lock.Lock()
+	granted, ok := p.accessTokens[accessToken]
+	p.lock.Unlock()
+	if !ok || time.Now().After(granted.expires) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	claims := map[string]interface{}{}
+	for k, v := range granted.user.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = granted.user.Username
+	writeJson(w, http.StatusOK, claims)
+}
+
+// The user's claims, with the standard ones taking precedence.
+func (p *Provider) idTokenClaims(granted *grant, now time.Time) map[string]interface{} {
+	claims := map[string]interface{}{}
+	for k, v := range granted.user.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = p.config.Issuer
+	claims["sub"] = granted.user.Username
+	claims["aud"] = granted.client.Id
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = now.Unix()
+	claims["exp"] = now.Add(tokenLifetime).Unix()
+	if granted.nonce != "" {
+		claims["nonce"] = granted.nonce
+	}
+	return claims
+}
+
+// sign encodes the claims as a JWT signed with RS256.
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyId})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) client(id string) (Client, bool) {
+	for _, client := range p.config.Clients {
+		if client.Id == id {
+			return client, true
+		}
+	}
+	return Client{}, false
+}
+
+func (p *Provider) user(username, password string) (User, bool) {
+	for _, user := range p.config.Users {
+		if user.Username == username && user.Password == password {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (c Client) allowsRedirect(redirectUri string) bool {
+	for _, allowed := range c.RedirectUris {
+		if allowed == redirectUri {
+			return true
+		}
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(redirectUri, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
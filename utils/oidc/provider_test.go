@@ -0,0 +1,258 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/login"
+	"github.com/solo-io/gloo-ref-arch/utils/oidc"
+)
+
+func TestOidc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mock OIDC Provider Suite")
+}
+
+const (
+	clientId     = "gloo"
+	clientSecret = "gloo-secret"
+)
+
+func getJson(url string, into interface{}) {
+	resp, err := http.Get(url)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(json.NewDecoder(resp.Body).Decode(into)).To(Succeed())
+}
+
+// verifyIdToken checks the token's signature against the provider's JWKS, and returns its claims.
+func verifyIdToken(issuer, token string) map[string]interface{} {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	getJson(issuer+oidc.JwksPath, &jwks)
+	Expect(jwks.Keys).To(HaveLen(1))
+	n, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	Expect(err).NotTo(HaveOccurred())
+	e, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	Expect(err).NotTo(HaveOccurred())
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	parts := strings.Split(token, ".")
+	Expect(parts).To(HaveLen(3))
+	var header map[string]string
+	decodeSegment(parts[0], &header)
+	Expect(header).To(HaveKeyWithValue("alg", "RS256"))
+	Expect(header).To(HaveKeyWithValue("kid", jwks.Keys[0].Kid))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	Expect(err).NotTo(HaveOccurred())
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	Expect(rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)).To(Succeed())
+
+	var claims map[string]interface{}
+	decodeSegment(parts[1], &claims)
+	return claims
+}
+
+func decodeSegment(segment string, into interface{}) {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.Unmarshal(b, into)).To(Succeed())
+}
+
+// A relying party like Gloo's oauth config: it sends users to the provider, exchanges the code for an ID token,
+// and keeps the verified email in a cookie.
+func appHandler(appUrl, issuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer GinkgoRecover()
+		if r.URL.Path == "/callback" {
+			Expect(r.URL.Query().Get("state")).To(Equal("some-state"))
+			resp, err := http.PostForm(issuer+oidc.TokenPath, url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {r.URL.Query().Get("code")},
+				"redirect_uri":  {appUrl + "/callback"},
+				"client_id":     {clientId},
+				"client_secret": {clientSecret},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var tokens map[string]interface{}
+			Expect(json.NewDecoder(resp.Body).Decode(&tokens)).To(Succeed())
+			claims := verifyIdToken(issuer, tokens["id_token"].(string))
+			Expect(claims).To(HaveKeyWithValue("iss", issuer))
+			Expect(claims).To(HaveKeyWithValue("aud", clientId))
+			Expect(claims).To(HaveKeyWithValue("nonce", "some-nonce"))
+			http.SetCookie(w, &http.Cookie{Name: "email", Value: claims["email"].(string), Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		if cookie, err := r.Cookie("email"); err == nil {
+			fmt.Fprintf(w, "Welcome %s", cookie.Value)
+			return
+		}
+		query := url.Values{
+			"client_id":     {clientId},
+			"redirect_uri":  {appUrl + "/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid email"},
+			"state":         {"some-state"},
+			"nonce":         {"some-nonce"},
+		}
+		http.Redirect(w, r, issuer+oidc.AuthorizePath+"?"+query.Encode(), http.StatusFound)
+	}
+}
+
+var _ = Describe("Mock OIDC provider", func() {
+	var (
+		idp, app *httptest.Server
+		issuer   string
+	)
+
+	start := func(issuerPath string) {
+		var provider *oidc.Provider
+		idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provider.ServeHTTP(w, r)
+		}))
+		app = httptest.NewServer(nil)
+		issuer = idp.URL + issuerPath
+		app.Config.Handler = appHandler(app.URL, issuer)
+		var err error
+		provider, err = oidc.NewProvider(oidc.Config{
+			Issuer: issuer,
+			Clients: []oidc.Client{{
+				Id:           clientId,
+				Secret:       clientSecret,
+				RedirectUris: []string{app.URL + "/*"},
+			}},
+			Users: []oidc.User{{
+				Username: "alice",
+				Password: "secret",
+				Claims:   map[string]interface{}{"email": "alice@example.com"},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// Logs in as alice, stopping at the redirect back to the app, and returns the code.
+	authorize := func() string {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := client.PostForm(issuer+oidc.AuthorizePath, url.Values{
+			"client_id":     {clientId},
+			"redirect_uri":  {app.URL + "/callback"},
+			"response_type": {"code"},
+			"username":      {"alice"},
+			"password":      {"secret"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusFound))
+		location, err := resp.Location()
+		Expect(err).NotTo(HaveOccurred())
+		return location.Query().Get("code")
+	}
+
+	exchange := func(code, secret string) *http.Response {
+		resp, err := http.PostForm(issuer+oidc.TokenPath, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {app.URL + "/callback"},
+			"client_id":     {clientId},
+			"client_secret": {secret},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	AfterEach(func() {
+		idp.Close()
+		app.Close()
+	})
+
+	Context("with an issuer at the root", func() {
+		BeforeEach(func() {
+			start("")
+		})
+
+		It("serves the discovery document", func() {
+			var discovery map[string]interface{}
+			getJson(issuer+oidc.DiscoveryPath, &discovery)
+			Expect(discovery).To(HaveKeyWithValue("issuer", issuer))
+			Expect(discovery).To(HaveKeyWithValue("authorization_endpoint", issuer+oidc.AuthorizePath))
+			Expect(discovery).To(HaveKeyWithValue("token_endpoint", issuer+oidc.TokenPath))
+			Expect(discovery).To(HaveKeyWithValue("jwks_uri", issuer+oidc.JwksPath))
+		})
+
+		It("logs users in with the authorization code flow", func() {
+			flow := &login.Flow{StartUrl: app.URL + "/", Username: "alice", Password: "secret"}
+			result, err := flow.Run()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.StatusCode).To(Equal(http.StatusOK))
+			Expect(result.Body).To(Equal("Welcome alice@example.com"))
+		})
+
+		It("shows the login form again for wrong credentials", func() {
+			flow := &login.Flow{StartUrl: app.URL + "/", Username: "alice", Password: "wrong"}
+			_, err := flow.Run()
+			Expect(err).To(MatchError(ContainSubstring("was shown again")))
+		})
+
+		It("rejects redirect URIs that aren't allowed for the client", func() {
+			resp, err := http.Get(issuer + oidc.AuthorizePath + "?" + url.Values{
+				"client_id":     {clientId},
+				"redirect_uri":  {"http://evil.example.com/callback"},
+				"response_type": {"code"},
+			}.Encode())
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects the wrong client secret", func() {
+			Expect(exchange(authorize(), "wrong").StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("only exchanges a code once", func() {
+			code := authorize()
+			Expect(exchange(code, clientSecret).StatusCode).To(Equal(http.StatusOK))
+			Expect(exchange(code, clientSecret).StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("with an issuer under a path", func() {
+		BeforeEach(func() {
+			start("/realms/demo")
+		})
+
+		It("serves the endpoints under the issuer's path", func() {
+			var discovery map[string]interface{}
+			getJson(issuer+oidc.DiscoveryPath, &discovery)
+			Expect(discovery).To(HaveKeyWithValue("token_endpoint", issuer+oidc.TokenPath))
+
+			flow := &login.Flow{StartUrl: app.URL + "/", Username: "alice", Password: "secret"}
+			result, err := flow.Run()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Body).To(Equal("Welcome alice@example.com"))
+		})
+	})
+})
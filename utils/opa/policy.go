@@ -0,0 +1,155 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/open-policy-agent/opa/rego"
+	errors "github.com/rotisserie/eris"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	NoOpaAuthConfigError = func(path string) error {
+		return errors.Errorf("AuthConfig %s has no opa_auth config", path)
+	}
+	NoModulesError = func(path string) error {
+		return errors.Errorf("ConfigMap %s has no rego modules", path)
+	}
+)
+
+// A Policy is a set of rego modules, along with the query an opa_auth AuthConfig evaluates against them.
+type Policy struct {
+	Modules map[string]string
+	Query   string
+}
+
+type authConfig struct {
+	Spec struct {
+		Configs []struct {
+			OpaAuth *struct {
+				Query string `json:"query"`
+			} `json:"opa_auth"`
+		} `json:"configs"`
+	} `json:"spec"`
+}
+
+// LoadPolicy reads the query from the opa_auth config in an AuthConfig, and the rego modules from the
+// ConfigMaps it references. AuthConfig templates (*.tmpl) are rendered with empty values first.
+func LoadPolicy(authConfigPath string, configMapPaths ...string) (*Policy, error) {
+	query, err := loadQuery(authConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{
+		Modules: make(map[string]string),
+		Query:   query,
+	}
+	for _, path := range configMapPaths {
+		modules, err := loadModules(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, module := range modules {
+			policy.Modules[name] = module
+		}
+	}
+	return policy, nil
+}
+
+// Allowed evaluates the query against the input, treating the request as allowed if the query
+// produces a result in which every expression is true (the way extauth does).
+func (p *Policy) Allowed(input interface{}) (bool, error) {
+	options := []func(*rego.Rego){
+		rego.Query(p.Query),
+		rego.Input(input),
+	}
+	for name, module := range p.Modules {
+		options = append(options, rego.Module(name, module))
+	}
+	results, err := rego.New(options...).Eval(context.TODO())
+	if err != nil {
+		return false, err
+	}
+	if len(results) == 0 {
+		return false, nil
+	}
+	for _, expression := range results[0].Expressions {
+		if expression.Value != true {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HeadersInput is the input extauth provides for a request with the given headers.
+func HeadersInput(headers map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"http_request": map[string]interface{}{
+			"headers": headers,
+		},
+	}
+}
+
+// StateJwtInput is the input extauth provides when a previous config (i.e. oauth) stored a JWT in the state.
+func StateJwtInput(jwt string) map[string]interface{} {
+	return map[string]interface{}{
+		"state": map[string]interface{}{
+			"jwt": jwt,
+		},
+	}
+}
+
+// UnsignedJwt builds a JWT with the given claims. io.jwt.decode doesn't verify signatures,
+// so this is enough to exercise policies that only inspect claims.
+func UnsignedJwt(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode(header) + "." + encode(payload) + "."
+}
+
+func loadQuery(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(path).Option("missingkey=zero").Parse(string(contents))
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, map[string]string{}); err != nil {
+		return "", err
+	}
+	var config authConfig
+	if err := yaml.Unmarshal(rendered.Bytes(), &config); err != nil {
+		return "", err
+	}
+	for _, c := range config.Spec.Configs {
+		if c.OpaAuth != nil {
+			return c.OpaAuth.Query, nil
+		}
+	}
+	return "", NoOpaAuthConfigError(path)
+}
+
+func loadModules(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configMap v1.ConfigMap
+	if err := yaml.Unmarshal(contents, &configMap); err != nil {
+		return nil, err
+	}
+	if len(configMap.Data) == 0 {
+		return nil, NoModulesError(path)
+	}
+	return configMap.Data, nil
+}
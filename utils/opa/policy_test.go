@@ -0,0 +1,73 @@
+package opa_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/opa"
+)
+
+func TestOpa(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OPA Policy Suite")
+}
+
+func tokenHeader(claims map[string]interface{}) map[string]interface{} {
+	return opa.HeadersInput(map[string]string{
+		"x-token": opa.UnsignedJwt(claims),
+	})
+}
+
+func stateJwt(claims map[string]interface{}) map[string]interface{} {
+	return opa.StateJwtInput(opa.UnsignedJwt(claims))
+}
+
+var _ = Describe("allow-jwt policies", func() {
+
+	expectAllowed := func(dir, authConfig string, input map[string]interface{}, expected bool) {
+		policy, err := opa.LoadPolicy(dir+"/"+authConfig, dir+"/allow-jwt.yaml")
+		Expect(err).To(BeNil())
+		Expect(policy.Query).To(Equal("data.test.allow == true"))
+		allowed, err := policy.Allowed(input)
+		Expect(err).To(BeNil())
+		Expect(allowed).To(Equal(expected))
+	}
+
+	typeEntries := []table.TableEntry{
+		table.Entry("Messenger", tokenHeader(map[string]interface{}{"type": "Messenger", "number": "311"}), true),
+		table.Entry("Whatsapp", tokenHeader(map[string]interface{}{"type": "Whatsapp", "number": "411"}), true),
+		table.Entry("SMS", tokenHeader(map[string]interface{}{"type": "SMS", "number": "200"}), false),
+		table.Entry("empty type", tokenHeader(map[string]interface{}{"type": "", "number": "200"}), false),
+		table.Entry("missing type", tokenHeader(map[string]interface{}{"number": "200"}), false),
+		table.Entry("missing token", opa.HeadersInput(map[string]string{}), false),
+	}
+
+	emailEntries := []table.TableEntry{
+		table.Entry("allowed email", stateJwt(map[string]interface{}{"email": "rick.ducott@solo.io"}), true),
+		table.Entry("other email", stateJwt(map[string]interface{}{"email": "someone@example.com"}), false),
+		table.Entry("missing email", stateJwt(map[string]interface{}{"sub": "1234"}), false),
+		table.Entry("missing jwt", map[string]interface{}{}, false),
+	}
+
+	table.DescribeTable("exposing-apis part1",
+		func(input map[string]interface{}, expected bool) {
+			expectAllowed("../../exposing-apis/part1", "auth-config.yaml", input, expected)
+		}, typeEntries...)
+
+	table.DescribeTable("advanced rate limit, based on jwt",
+		func(input map[string]interface{}, expected bool) {
+			expectAllowed("../../webinars/advanced-rate-limit/4-based-on-jwt", "auth-config.yaml", input, expected)
+		}, typeEntries...)
+
+	table.DescribeTable("user-auth-and-audit part1",
+		func(input map[string]interface{}, expected bool) {
+			expectAllowed("../../user-auth-and-audit/part1", "auth-config.tmpl", input, expected)
+		}, emailEntries...)
+
+	table.DescribeTable("user-auth-and-audit part2",
+		func(input map[string]interface{}, expected bool) {
+			expectAllowed("../../user-auth-and-audit/part2", "auth-config.yaml", input, expected)
+		}, emailEntries...)
+})
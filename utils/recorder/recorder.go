@@ -0,0 +1,170 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Envoy appends this to the host header (including any port) of the requests it mirrors to a shadow upstream.
+	shadowHostSuffix = "-shadow"
+
+	// Requests can ask the recorder to misbehave, for testing route options like timeouts and retries.
+	// DelayHeader is how long to wait before responding, e.g. 3s.
+	DelayHeader = "x-delay"
+	// ErrorRateHeader is the percentage of requests to fail with a 500, like spelunker's.
+	ErrorRateHeader = "x-error-rate"
+
+	ServerErrorResponse = "Server error!"
+)
+
+// A Request is what the recorder saw of a request it served.
+type Request struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	// Whether the request was mirrored by Envoy's shadowing, rather than routed to this version.
+	Shadow bool `json:"shadow"`
+	// The first value of each header, keyed by lower case name.
+	Headers map[string]string `json:"headers"`
+}
+
+// A Filter selects requests. Empty fields match everything.
+type Filter struct {
+	Path   string
+	Shadow *bool
+	// Selects requests that had the header, e.g. to check that one removed by the route options never arrived.
+	Header string
+}
+
+func (f Filter) Matches(r Request) bool {
+	_, hasHeader := r.Headers[strings.ToLower(f.Header)]
+	return (f.Path == "" || f.Path == r.Path) &&
+		(f.Shadow == nil || *f.Shadow == r.Shadow) &&
+		(f.Header == "" || hasHeader)
+}
+
+// A Recorder responds to every request with fixed text, like hashicorp/http-echo, and remembers the requests so
+// that workflows can check which version of an app was sent traffic, including traffic clients never see the
+// responses to.
+type Recorder struct {
+	text string
+
+	lock     sync.RWMutex
+	requests []Request
+}
+
+func NewRecorder(text string) *Recorder {
+	return &Recorder{text: text}
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	headers := make(map[string]string)
+	for name := range request.Header {
+		headers[strings.ToLower(name)] = request.Header.Get(name)
+	}
+	r.add(Request{
+		Method:  request.Method,
+		Host:    request.Host,
+		Path:    request.URL.Path,
+		Shadow:  strings.HasSuffix(request.Host, shadowHostSuffix),
+		Headers: headers,
+	})
+	w.Header().Set("Content-Type", "text/plain")
+
+	if delay := request.Header.Get(DelayHeader); delay != "" {
+		duration, err := time.ParseDuration(delay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing delay %s: %s", delay, err), http.StatusBadRequest)
+			return
+		}
+		time.Sleep(duration)
+	}
+	if errorRate := request.Header.Get(ErrorRateHeader); errorRate != "" {
+		rate, err := strconv.Atoi(errorRate)
+		if err != nil || rate < 0 || rate > 100 {
+			http.Error(w, fmt.Sprintf("Invalid error rate: %s", errorRate), http.StatusBadRequest)
+			return
+		}
+		if rand.Intn(100) < rate {
+			http.Error(w, ServerErrorResponse, http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Fprintln(w, r.text)
+}
+
+func (r *Recorder) add(request Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests = append(r.requests, request)
+}
+
+func (r *Recorder) Requests(filter Filter) []Request {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	result := []Request{}
+	for _, request := range r.requests {
+		if filter.Matches(request) {
+			result = append(result, request)
+		}
+	}
+	return result
+}
+
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests = nil
+}
+
+// Admin lists the recorded requests on GET /requests, and counts them on GET /requests/count, filtered by the path,
+// shadow and header query parameters. It clears them on DELETE /requests. It is served on its own port, so it can't be
+// reached through the gateway.
+func (r *Recorder) Admin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		switch {
+		case request.URL.Path == "/requests" && request.Method == http.MethodGet:
+			filter, err := parseFilter(request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(r.Requests(filter))
+		case request.URL.Path == "/requests/count" && request.Method == http.MethodGet:
+			filter, err := parseFilter(request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintln(w, len(r.Requests(filter)))
+		case request.URL.Path == "/requests" && request.Method == http.MethodDelete:
+			r.Reset()
+		case request.URL.Path == "/requests" || request.URL.Path == "/requests/count":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, request)
+		}
+	})
+}
+
+func parseFilter(request *http.Request) (Filter, error) {
+	query := request.URL.Query()
+	filter := Filter{Path: query.Get("path"), Header: query.Get("header")}
+	if shadow := query.Get("shadow"); shadow != "" {
+		parsed, err := strconv.ParseBool(shadow)
+		if err != nil {
+			return filter, err
+		}
+		filter.Shadow = &parsed
+	}
+	return filter, nil
+}
@@ -0,0 +1,167 @@
+package recorder_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/gloo-ref-arch/utils/recorder"
+)
+
+func TestRecorder(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Request Recorder Suite")
+}
+
+var _ = Describe("Request recorder", func() {
+	var (
+		rec        *recorder.Recorder
+		app, admin *httptest.Server
+	)
+
+	BeforeEach(func() {
+		rec = recorder.NewRecorder("version:echo-v2")
+		app = httptest.NewServer(rec)
+		admin = httptest.NewServer(rec.Admin())
+	})
+
+	AfterEach(func() {
+		app.Close()
+		admin.Close()
+	})
+
+	do := func(path, host string, headers map[string]string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, app.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Host = host
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(body)
+	}
+
+	get := func(path, host string) string {
+		_, body := do(path, host, nil)
+		return body
+	}
+
+	adminGet := func(path string) string {
+		resp, err := http.Get(admin.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	// Requests without their headers, which include ones added by the client
+	withoutHeaders := func(requests []recorder.Request) []recorder.Request {
+		for i := range requests {
+			requests[i].Headers = nil
+		}
+		return requests
+	}
+
+	listRequests := func(query string) []recorder.Request {
+		resp, err := http.Get(admin.URL + "/requests" + query)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var requests []recorder.Request
+		Expect(json.NewDecoder(resp.Body).Decode(&requests)).To(Succeed())
+		return requests
+	}
+
+	It("responds with its text, like http-echo", func() {
+		Expect(get("/echo/foo", "example.com")).To(Equal("version:echo-v2\n"))
+	})
+
+	It("tells requests mirrored by Envoy apart from routed ones", func() {
+		get("/echo/foo", "example.com")
+		get("/echo/foo", "example.com:8080-shadow")
+		get("/echo/bar", "example.com-shadow")
+
+		Expect(listRequests("")).To(HaveLen(3))
+		Expect(listRequests("?path=/echo/foo")).To(HaveLen(2))
+		Expect(withoutHeaders(listRequests("?shadow=false"))).To(ConsistOf(
+			recorder.Request{Method: "GET", Host: "example.com", Path: "/echo/foo", Shadow: false},
+		))
+		Expect(withoutHeaders(listRequests("?path=/echo/foo&shadow=true"))).To(ConsistOf(
+			recorder.Request{Method: "GET", Host: "example.com:8080-shadow", Path: "/echo/foo", Shadow: true},
+		))
+	})
+
+	It("lists an empty array when nothing matches, and clears requests", func() {
+		get("/echo/foo", "example.com")
+		req, err := http.NewRequest(http.MethodDelete, admin.URL+"/requests", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(adminGet("/requests")).To(Equal("[]\n"))
+		Expect(adminGet("/requests/count")).To(Equal("0\n"))
+	})
+
+	It("counts requests, e.g. to check how many times a request was retried", func() {
+		get("/api/retries", "example.com")
+		get("/api/retries", "example.com")
+		get("/api", "example.com")
+		Expect(adminGet("/requests/count?path=/api/retries")).To(Equal("2\n"))
+		Expect(adminGet("/requests/count")).To(Equal("3\n"))
+	})
+
+	It("records request headers by lower case name", func() {
+		do("/echo/foo", "example.com", map[string]string{"X-Gloo-App": "echo"})
+		requests := listRequests("")
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Headers).To(HaveKeyWithValue("x-gloo-app", "echo"))
+	})
+
+	It("counts requests that had a header, e.g. to check that one was removed", func() {
+		do("/api", "example.com", map[string]string{"X-Internal": "true"})
+		do("/api", "example.com", nil)
+		Expect(adminGet("/requests/count?path=/api&header=x-internal")).To(Equal("1\n"))
+		Expect(adminGet("/requests/count?path=/api&header=X-Internal")).To(Equal("1\n"))
+		Expect(adminGet("/requests/count?path=/api&header=x-other")).To(Equal("0\n"))
+	})
+
+	It("fails requests with the error rate header", func() {
+		code, body := do("/echo/foo", "example.com", map[string]string{recorder.ErrorRateHeader: "100"})
+		Expect(code).To(Equal(http.StatusInternalServerError))
+		Expect(body).To(Equal(recorder.ServerErrorResponse + "\n"))
+		code, body = do("/echo/foo", "example.com", map[string]string{recorder.ErrorRateHeader: "0"})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("version:echo-v2\n"))
+		code, _ = do("/echo/foo", "example.com", map[string]string{recorder.ErrorRateHeader: "101"})
+		Expect(code).To(Equal(http.StatusBadRequest))
+		// Failed requests are recorded too
+		Expect(listRequests("")).To(HaveLen(3))
+	})
+
+	It("delays responses with the delay header", func() {
+		start := time.Now()
+		code, _ := do("/echo/foo", "example.com", map[string]string{recorder.DelayHeader: "200ms"})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		code, _ = do("/echo/foo", "example.com", map[string]string{recorder.DelayHeader: "soon"})
+		Expect(code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects bad filters", func() {
+		resp, err := http.Get(admin.URL + "/requests?shadow=maybe")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
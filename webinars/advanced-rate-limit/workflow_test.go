@@ -0,0 +1,25 @@
+package advancedratelimit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	advancedratelimit "github.com/solo-io/gloo-ref-arch/webinars/advanced-rate-limit"
+	"testing"
+)
+
+func TestAdvancedRateLimit(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Advanced Rate Limit Suite")
+}
+
+var _ = Describe("Advanced rate limit", func() {
+	testWorkflow := advancedratelimit.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -0,0 +1,183 @@
+package devportal
+
+import (
+	"context"
+	"fmt"
+	"github.com/solo-io/gloo-ref-arch/utils/bash"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	// The dev portal shipped with Gloo Enterprise 1.3, and its resources changed after, so the webinar's release is
+	// pinned rather than following the default.
+	glooEnterpriseVersion = "1.3.2"
+	// Enabled by values.yaml. A release installed by another workflow doesn't have it, so it is reinstalled.
+	devPortalDeployment = "dev-portal"
+
+	petsResponse = `[{"id":1,"name":"Dog","status":"available"},{"id":2,"name":"Cat","status":"pending"}]`
+
+	// The label the portal puts on keys issued for the pet-key-scope, selected by the apikey-auth AuthConfig.
+	keyScopeLabel = "portals.devportal.solo.io/gloo-system.pet-store.pet-key-scope"
+	scopedKey     = "pet-store-scoped-key"
+	unscopedKey   = "pet-store-unscoped-key"
+
+	// The portal is served by the dev-portal deployment for its domain, localhost:1234, which is port-forwarded so
+	// that requests have the portal's host.
+	portalPort     = 8080
+	portalHostPort = 1234
+	// The published spec of the petstore ApiDoc, as the portal's pages fetch it.
+	portalApiDocPath = "/api/portals/gloo-system/pet-store/apidocs/gloo-system/petstore/spec"
+	// Only openapi-2.json requires an api-key.
+	apiKeySecurityDefinition = "petStoreApiKey"
+	attempts                 = 30
+)
+
+func curlPets(status int, apiKey string) *workflow.Step {
+	step := &workflow.Step{
+		Curl: &check.Curl{
+			Service:    gloo.GatewayProxy(),
+			Host:       "localhost:8080",
+			Path:       "/api/pets",
+			StatusCode: status,
+			Attempts:   30,
+		},
+	}
+	if status == 200 {
+		step.Curl.ResponseBody = petsResponse
+	}
+	if apiKey != "" {
+		step.Curl.Headers = map[string]string{
+			"api-key": apiKey,
+		}
+	}
+	return step
+}
+
+func publishApiDoc(openApi string) *workflow.Step {
+	return workflow.ApplyTemplate("apidoc.tmpl").WithValue("OpenApi", "file:"+openApi)
+}
+
+func deployPortal() *workflow.Step {
+	return workflow.ApplyTemplate("portal.tmpl").
+		WithValue("PrimaryLogo", "file:Gloo-01.png").
+		WithValue("Favicon", "file:favicon.ico")
+}
+
+func devPortalCondition(kind, name, jsonpath, value string) *workflow.Step {
+	return &workflow.Step{
+		Condition: &check.Condition{
+			Type:      kind + ".devportal.solo.io",
+			Name:      name,
+			Namespace: "gloo-system",
+			Jsonpath:  jsonpath,
+			Value:     value,
+		},
+	}
+}
+
+// The dev portal parses the spec and records the result on the ApiDoc status.
+func apiDocProcessed() *workflow.Step {
+	return devPortalCondition("apidocs", "petstore", "{.status.state}", "Succeeded")
+}
+
+func portalPublishesApiDoc() *workflow.Step {
+	return devPortalCondition("portals", "pet-store", "{.status.publishedApiDocs[*].name}", "petstore")
+}
+
+func keyScopeIncludesApiDoc() *workflow.Step {
+	return devPortalCondition("portals", "pet-store", "{.status.keyScopes[?(@.name==\"pet-key-scope\")].accessibleApiDocs[*].name}", "petstore")
+}
+
+// portalServesApiDoc fetches the petstore spec from the portal, as a developer browsing it would, and checks that it is
+// the published openapi-1.json or openapi-2.json, i.e. with or without the api-key security definition.
+func portalServesApiDoc(requiresApiKey bool) *workflow.Step {
+	check := fmt.Sprintf(`[ -z "$(echo "$spec" | grep %s)" ]`, apiKeySecurityDefinition)
+	description := "the portal to serve the petstore spec without an api-key requirement"
+	if requiresApiKey {
+		check = fmt.Sprintf(`[ -n "$(echo "$spec" | grep %s)" ]`, apiKeySecurityDefinition)
+		description = "the portal to serve the petstore spec requiring an api-key"
+	}
+	lines := bash.PortForwardLines(bash.PortForward{
+		Namespace: "gloo-system", Resource: "deploy/" + devPortalDeployment, Port: portalPort, LocalPort: portalHostPort,
+	})
+	lines = append(lines, bash.RetryLines(attempts, 1, []string{
+		fmt.Sprintf(`spec="$(curl -s http://localhost:%d%s)"`, portalHostPort, portalApiDocPath),
+		fmt.Sprintf(`if [ -n "$(echo "$spec" | grep 'Swagger Petstore')" ] && %s; then echo %s; exit 0; fi`,
+			check, bash.Quote("The portal serves the petstore spec")),
+	}, description, `echo "Last response: $spec"`)...)
+	return bash.Step(lines...)
+}
+
+// Stands in for a developer requesting a key for a scope in the portal, which stores it as a labelled Gloo API key secret.
+// An empty label creates a key that doesn't belong to any scope.
+func createApiKey(name, apiKey, label string) *workflow.Step {
+	labelFlag := ""
+	if label != "" {
+		labelFlag = " --apikey-labels " + label
+	}
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("kubectl delete secret -n gloo-system %s --ignore-not-found && glooctl create secret apikey %s --namespace gloo-system --apikey %s%s",
+				name, name, apiKey, labelFlag),
+		},
+	}
+}
+
+func installGlooEnterprise() *workflow.Step {
+	step := gloo.InstallGlooEnterpriseVersion(glooEnterpriseVersion, gloo.DefaultLicense())
+	step.InstallHelmChart.ValuesFiles = []string{"values.yaml"}
+	return step
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.UninstallOtherGlooVersions("gloo-ee-"+glooEnterpriseVersion, devPortalDeployment),
+			installGlooEnterprise(),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy the petstore and expose it
+			workflow.Apply("petstore.yaml").WithId("deploy-petstore"),
+			workflow.WaitForPods("gloo-system").WithId("wait-petstore"),
+			workflow.Apply("vs.yaml").WithId("deploy-vs"),
+			curlPets(200, ""),
+
+			// Part 2: Publish the API doc on the portal
+			deployPortal().WithId("deploy-portal"),
+			publishApiDoc("openapi-1.json").WithId("publish-openapi-1"),
+			apiDocProcessed(),
+			portalPublishesApiDoc(),
+			keyScopeIncludesApiDoc(),
+			portalServesApiDoc(false),
+
+			// Part 3: Publish the API doc requiring an api-key, and guard the API with keys from the portal
+			publishApiDoc("openapi-2.json").WithId("publish-openapi-2"),
+			apiDocProcessed(),
+			portalServesApiDoc(true),
+			workflow.Apply("auth-config.yaml").WithId("deploy-auth-config"),
+			workflow.Apply("vs-2.yaml").WithId("deploy-vs-2"),
+			curlPets(401, ""),
+			createApiKey("pet-store-scoped-key", scopedKey, keyScopeLabel+"=true"),
+			createApiKey("pet-store-unscoped-key", unscopedKey, ""),
+			curlPets(200, scopedKey),
+			curlPets(401, unscopedKey),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package devportal_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	devportal "github.com/solo-io/gloo-ref-arch/webinars/dev-portal"
+	"testing"
+)
+
+func TestDevPortal(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Dev Portal Suite")
+}
+
+var _ = Describe("Dev portal", func() {
+	testWorkflow := devportal.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
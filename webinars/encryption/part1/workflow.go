@@ -0,0 +1,122 @@
+package part1
+
+import (
+	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/certs"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	domain1 = "spelunker.com"
+	domain2 = "spelunker2.com"
+
+	// Spelunker reports which of its ports served the request.
+	httpResponse  = "This is an example http server."
+	httpsResponse = "This is an example https server."
+	// Envoy's response when it can't connect to the upstream, e.g. because it fails to verify its certificate.
+	upstreamConnectError = "upstream connect error"
+)
+
+func curlHttp(domain, response string) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:               gloo.GatewayProxy(),
+			Host:                  domain,
+			Path:                  "/",
+			StatusCode:            200,
+			ResponseBodySubstring: response,
+			Attempts:              30,
+		},
+	}
+}
+
+// Waits until a request for the domain fails, because Envoy can't connect to the upstream.
+func curlHttpUpstreamError(domain string) *workflow.Step {
+	step := curlHttp(domain, upstreamConnectError)
+	step.Curl.StatusCode = 503
+	return step
+}
+
+func curlHttps(domain, response string) *workflow.Step {
+	return gloo.CurlHttps(domain, "/", certs.RootCACert(), response)
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.InstallGloo(),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			certs.CreateRootCA(),
+			certs.CreateUntrustedRootCA(),
+			certs.CreateCertificate(domain1),
+			certs.CreateCertificate(domain2),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy spelunker, serving https with the spelunker.com certificate
+			workflow.Apply("spelunker.yaml").WithId("deploy-spelunker"),
+			certs.CreateTlsSecret("spelunker", "tls.spelunker.com", domain1),
+			workflow.WaitForPods("spelunker").WithId("wait-spelunker"),
+
+			// Part 2: http client to http upstream
+			workflow.Apply("upstream.http.spelunker.yaml").WithId("upstream-http"),
+			workflow.Apply("vs.http.spelunker.com.yaml").WithId("vs-http-spelunker"),
+			curlHttp(domain1, httpResponse),
+
+			// Part 3: https client to https upstream
+			workflow.Apply("upstream.tls.spelunker.yaml").WithId("upstream-tls"),
+			workflow.Apply("vs.https.spelunker.com.yaml").WithId("vs-https-spelunker"),
+			curlHttps(domain1, httpsResponse),
+
+			// Part 4: http client to https upstream
+			workflow.Apply("vs.http.spelunker2.com.yaml").WithId("vs-http-spelunker2"),
+			curlHttp(domain2, httpsResponse),
+
+			// Part 5: https client to http upstream, initially serving the certificate for the wrong domain
+			workflow.Apply("vs.https.spelunker2.com.yaml").WithId("vs-https-spelunker2"),
+			gloo.CurlHttpsCertificateError(domain2, certs.RootCACert()),
+
+			// Part 6: The right certificate isn't enough, since Envoy can't select between the two certificates without SNI
+			certs.CreateTlsSecret("spelunker", "tls.spelunker2.com", domain2),
+			workflow.Apply("vs.https.spelunker2.com-fixed.yaml").WithId("vs-https-spelunker2-fixed"),
+			gloo.CurlHttpsCertificateError(domain2, certs.RootCACert()),
+
+			// Part 7: Add SNI domains to both https virtual services
+			workflow.Apply("vs.https.spelunker.com-sni.yaml").WithId("vs-https-spelunker-sni"),
+			workflow.Apply("vs.https.spelunker2.com-sni.yaml").WithId("vs-https-spelunker2-sni"),
+			curlHttps(domain2, httpResponse),
+			curlHttps(domain1, httpsResponse),
+
+			// Part 8: Verify the upstream certificate with the root CA, for mutual TLS to the upstream
+			certs.CreateMtlsSecret("spelunker", "mtls.spelunker.com", domain1),
+			workflow.Apply("upstream.mtls.spelunker.yaml").WithId("upstream-mtls"),
+			workflow.Apply("vs.https.spelunker.com-mtls.yaml").WithId("vs-https-spelunker-mtls"),
+			workflow.Apply("vs.http.spelunker2.com-mtls.yaml").WithId("vs-http-spelunker2-mtls"),
+			curlHttp(domain1, httpResponse),
+			curlHttps(domain1, httpsResponse),
+			curlHttp(domain2, httpsResponse),
+			curlHttps(domain2, httpResponse),
+
+			// Part 9: Envoy rejects the upstream when its certificate isn't signed by the root CA in the secret
+			certs.CreateMtlsSecretWithRootCA("spelunker", "mtls-untrusted.spelunker.com", domain1, certs.UntrustedRootCACert()),
+			workflow.Apply("upstream.mtls-untrusted.spelunker.yaml").WithId("upstream-mtls-untrusted"),
+			workflow.Apply("vs.http.spelunker2.com-mtls-untrusted.yaml").WithId("vs-http-spelunker2-mtls-untrusted"),
+			curlHttpUpstreamError(domain2),
+			workflow.Apply("vs.http.spelunker2.com-mtls.yaml").WithId("vs-http-spelunker2-mtls-restored"),
+			curlHttp(domain2, httpsResponse),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package part1_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"github.com/solo-io/gloo-ref-arch/webinars/encryption/part1"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Encryption Part 1 Suite")
+}
+
+var _ = Describe("Part 1", func() {
+	testWorkflow := part1.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
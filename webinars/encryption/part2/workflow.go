@@ -0,0 +1,95 @@
+package part2
+
+import (
+	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/certs"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	domain = "spelunker.com"
+
+	// Envoy and spelunker each get their own certificate for the domain, so that the certificate a client sees shows
+	// which of them terminated TLS.
+	envoyCertificate  = domain + "-envoy"
+	serverCertificate = domain + "-server"
+	secret            = "tls." + domain
+
+	// Spelunker reports which of its ports served the request.
+	httpResponse  = "This is an example http server."
+	httpsResponse = "This is an example https server."
+)
+
+// The http gateway passes TCP through to spelunker's http port.
+func curlHttp() *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:               gloo.GatewayProxy(),
+			Path:                  "/",
+			StatusCode:            200,
+			ResponseBodySubstring: httpResponse,
+			Attempts:              30,
+		},
+	}
+}
+
+// Envoy doesn't verify spelunker's certificate, and the client isn't given the root CA, so certificates are checked
+// by fingerprint instead.
+func curlHttps() *workflow.Step {
+	return gloo.CurlHttps(domain, "/", "", httpsResponse)
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.InstallGloo(),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.BackupGateways(),
+			certs.CreateRootCA(),
+			certs.CreateNamedCertificate(envoyCertificate, domain),
+			certs.CreateNamedCertificate(serverCertificate, domain),
+		},
+		Steps: []*workflow.Step{
+			// Part 1: Deploy spelunker, with a TLS secret for the server and a different one for Envoy
+			workflow.Apply("spelunker.yaml").WithId("deploy-spelunker"),
+			certs.CreateTlsSecret("spelunker", secret, serverCertificate),
+			certs.CreateTlsSecret("gloo-system", secret, envoyCertificate),
+			workflow.WaitForPods("spelunker").WithId("wait-spelunker"),
+			gloo.AssertUpstreamCertificate(domain, "spelunker", "spelunker", 8443, secret),
+
+			// Part 2: Create the upstreams
+			workflow.Apply("upstream.http.spelunker.yaml").WithId("upstream-http"),
+			workflow.Apply("upstream.tls.spelunker.yaml").WithId("upstream-tls"),
+
+			// Part 3: Turn the gateways into TCP proxies
+			workflow.Apply("gateway-proxy.yaml").WithId("gateway-proxy-tcp"),
+			workflow.Apply("gateway-proxy-ssl.yaml").WithId("gateway-proxy-ssl-tcp"),
+			curlHttp(),
+			// Envoy terminates TLS with its own certificate rather than passing through spelunker's, and re-encrypts
+			// to spelunker's https port, which still serves the server certificate
+			gloo.AssertServedCertificate(domain, "gloo-system", secret),
+			curlHttps(),
+			gloo.AssertUpstreamCertificate(domain, "spelunker", "spelunker", 8443, secret),
+
+			// Cleanup: restore the default gateways
+			gloo.RestoreGateways(),
+			certs.DeleteSecret("gloo-system", secret),
+			gloo.DeleteNamespaces("spelunker"),
+			gloo.GlooctlCheck(),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package part2_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	"github.com/solo-io/gloo-ref-arch/webinars/encryption/part2"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Encryption Part 2 Suite")
+}
+
+var _ = Describe("Part 2", func() {
+	testWorkflow := part2.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -0,0 +1,93 @@
+#!/usr/bin/env bash
+#
+# Serves the wasm modules from a registry in the cluster, so that the workflow doesn't depend on WebAssembly Hub.
+#
+#   wasm.sh ensure                         fetch the modules used in this webinar that aren't in the module dir yet
+#   wasm.sh fetch IMAGE NAME               pull a module into the module dir, i.e. on a machine with registry access
+#   wasm.sh push NAME TAG ROOT_ID          push a module from the module dir to the in-cluster registry
+#
+# Configured with:
+#   WASM_MODULE_DIR   where modules are kept, one directory per NAME, defaults to _output/wasm in the repo root, next
+#                     to the chart cache of utils/cluster/local-cluster.sh
+
+set -e
+
+module_dir="${WASM_MODULE_DIR:-$(git rev-parse --show-toplevel)/_output/wasm}"
+registry_port=5000
+
+# The modules used in this webinar, as IMAGE NAME
+modules=(
+  "webassemblyhub.io/solo.io/metrics:gloo-1.3.x metrics"
+  "webassemblyhub.io/ilackarms/add-header:v0.1 add-header"
+)
+
+# Media types of the wasm module image spec, as read by Gloo's wasm plugin
+config_media_type="application/vnd.module.wasm.config.v1+json"
+content_media_type="application/vnd.module.wasm.content.layer.v1+wasm"
+
+fetch() {
+  local image="$1" name="$2"
+  mkdir -p "$module_dir/$name"
+  echo "Fetching $image into $module_dir/$name"
+  (cd "$module_dir/$name" && oras pull --allow-all "$image")
+}
+
+ensure() {
+  for entry in "${modules[@]}"; do
+    read -r image name <<< "$entry"
+    if ls "$module_dir/$name"/*.wasm >/dev/null 2>&1; then
+      echo "$name is already in $module_dir/$name"
+      continue
+    fi
+    command -v oras >/dev/null || { echo "$name isn't in $module_dir/$name, and fetching it needs the oras CLI"; exit 1; }
+    fetch "$image" "$name"
+  done
+}
+
+push() {
+  local name="$1" tag="$2" root_id="$3"
+  local module
+  module="$(ls "$module_dir/$name"/*.wasm 2>/dev/null | head -1)"
+  if [ -z "$module" ]; then
+    echo "No module found in $module_dir/$name, run '$0 ensure' with registry access first"
+    exit 1
+  fi
+
+  kubectl port-forward -n gloo-system svc/wasm-registry $registry_port >/dev/null 2>&1 &
+  pf=$!
+  trap 'kill $pf' EXIT
+  for i in $(seq 30); do
+    curl -sk -o /dev/null https://localhost:$registry_port/v2/ && break
+    sleep 1
+  done
+
+  # oras records file names relative to where it runs, so the module and its config are pushed from a scratch dir
+  local work
+  work="$(mktemp -d)"
+  cp "$module" "$work/filter.wasm"
+  echo "{\"type\":\"envoy_proxy\",\"rootIds\":[\"$root_id\"]}" > "$work/runtime-config.json"
+  echo "Pushing $module to the in-cluster registry as $name:$tag"
+  (cd "$work" && oras push --insecure "localhost:$registry_port/$name:$tag" \
+    --manifest-config "runtime-config.json:$config_media_type" \
+    "filter.wasm:$content_media_type")
+  rm -r "$work"
+}
+
+command="$1"
+shift || true
+
+case "$command" in
+  ensure) ensure ;;
+  fetch)
+    [ $# -eq 2 ] || { echo "Usage: $0 fetch IMAGE NAME"; exit 1; }
+    fetch "$@"
+    ;;
+  push)
+    [ $# -eq 3 ] || { echo "Usage: $0 push NAME TAG ROOT_ID"; exit 1; }
+    push "$@"
+    ;;
+  *)
+    echo "Usage: $0 ensure|fetch IMAGE NAME|push NAME TAG ROOT_ID"
+    exit 1
+    ;;
+esac
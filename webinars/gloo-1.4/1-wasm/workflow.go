@@ -0,0 +1,164 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/solo-io/gloo-ref-arch/utils/certs"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/step/script"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	glooVersion = "1.4.5"
+
+	// Gloo pulls the modules from this registry instead of WebAssembly Hub, see wasm.sh.
+	registryHost   = "wasm-registry.gloo-system.svc.cluster.local"
+	registrySecret = "wasm-registry-tls"
+	// The root CA, which Gloo is patched to trust, so that it can verify the registry's certificate.
+	registryCaSecret = "wasm-registry-ca"
+
+	// The add-header filter adds its config as the value of this response header.
+	filterHeader = "hello"
+	filterValue  = "World!"
+)
+
+type module struct {
+	name   string
+	tag    string
+	rootId string
+}
+
+var (
+	metricsModule   = module{name: "metrics", tag: "gloo-1.3.x", rootId: "stats_root_id"}
+	addHeaderModule = module{name: "add-header", tag: "v0.1", rootId: "add_header"}
+)
+
+func (m module) image() string {
+	return fmt.Sprintf("%s:5000/%s:%s", registryHost, m.name, m.tag)
+}
+
+// Fetches the modules from WebAssembly Hub, unless they were fetched before, e.g. by local-cluster.sh save.
+func fetchModules() *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: "./wasm.sh ensure",
+		},
+	}
+}
+
+func pushModule(m module) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf("./wasm.sh push %s %s %s", m.name, m.tag, m.rootId),
+		},
+	}
+}
+
+// The patches are kept as in the guide, so the filter image is pointed at the in-cluster registry when applying them.
+func patchGateway(path string, m module) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf(`kubectl patch -n gloo-system gateway gateway-proxy --type merge --patch "$(sed 's#image: .*#image: %s#' %s)"`,
+				m.image(), path),
+		},
+	}
+}
+
+// Patches the gloo deployment, and waits for it to roll out.
+func patchGloo(path string) *workflow.Step {
+	return &workflow.Step{
+		Bash: &script.Bash{
+			Inline: fmt.Sprintf(`kubectl patch -n gloo-system deployment gloo --patch "$(cat %s)" && kubectl rollout status -n gloo-system deployment gloo --timeout 120s`,
+				path),
+		},
+	}
+}
+
+func proxyAccepted() *workflow.Step {
+	return &workflow.Step{
+		Condition: &check.Condition{
+			Type:      "proxy",
+			Name:      "gateway-proxy",
+			Namespace: "gloo-system",
+			Jsonpath:  "{.status.state}",
+			Value:     "1",
+		},
+	}
+}
+
+func curlSpelunker() *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:    gloo.GatewayProxy(),
+			Path:       "/",
+			StatusCode: 200,
+			Attempts:   30,
+		},
+	}
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.UninstallOtherGlooVersions("gloo-" + glooVersion),
+			gloo.InstallGlooVersion(glooVersion, "values.yaml"),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.BackupGateways(),
+			fetchModules(),
+		},
+		Steps: []*workflow.Step{
+			// Serve the modules from the cluster
+			certs.CreateRootCA(),
+			certs.CreateCertificate(registryHost),
+			certs.CreateTlsSecret("gloo-system", registrySecret, registryHost),
+			certs.CreateRootCASecret("gloo-system", registryCaSecret),
+			patchGloo("gloo-patch-registry-ca.yaml").WithId("trust-wasm-registry-ca"),
+			workflow.Apply("wasm-registry.yaml").WithId("deploy-wasm-registry"),
+			workflow.WaitForPods("gloo-system").WithId("wait-wasm-registry"),
+			pushModule(metricsModule),
+			pushModule(addHeaderModule),
+
+			// Deploy our demo application, and make sure our route works
+			workflow.Apply("spelunker.yaml").WithId("deploy-spelunker"),
+			workflow.WaitForPods("spelunker").WithId("wait-spelunker"),
+			workflow.Apply("vs.yaml").WithId("vs"),
+			curlSpelunker(),
+			gloo.CurlWithoutResponseHeader("/", filterHeader),
+
+			// Deploy the metrics filter, which doesn't change the response
+			patchGateway("gateway-patch.yaml", metricsModule),
+			proxyAccepted(),
+			curlSpelunker(),
+			gloo.CurlWithoutResponseHeader("/", filterHeader),
+
+			// Replace it with our filter, and see the new response header
+			patchGateway("gateway-patch-2.yaml", addHeaderModule),
+			proxyAccepted(),
+			gloo.CurlResponseHeader("/", filterHeader, filterValue),
+
+			// Cleanup
+			gloo.RestoreGateways(),
+			workflow.Delete("vs.yaml").WithId("delete-vs"),
+			workflow.Delete("wasm-registry.yaml").WithId("delete-wasm-registry"),
+			patchGloo("gloo-patch-registry-ca-revert.yaml").WithId("untrust-wasm-registry-ca"),
+			certs.DeleteSecret("gloo-system", registryCaSecret),
+			gloo.DeleteNamespaces("spelunker"),
+			gloo.GlooctlCheck(),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package wasm_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	wasm "github.com/solo-io/gloo-ref-arch/webinars/gloo-1.4/1-wasm"
+	"testing"
+)
+
+func TestWasm(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Gloo 1.4 Wasm Suite")
+}
+
+var _ = Describe("Wasm", func() {
+	testWorkflow := wasm.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
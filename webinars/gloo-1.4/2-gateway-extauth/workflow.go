@@ -0,0 +1,116 @@
+package gatewayextauth
+
+import (
+	"context"
+
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
+	"github.com/solo-io/gloo-ref-arch/utils/gloo"
+	"github.com/solo-io/valet/pkg/step/check"
+	"github.com/solo-io/valet/pkg/tests"
+	"github.com/solo-io/valet/pkg/workflow"
+)
+
+const (
+	glooEnterpriseVersion = "1.4.0"
+
+	// The second gateway's listener, which isn't exposed by the gateway-proxy service.
+	secondListenerPort = 8081
+
+	// Each auth server in the stand-in allows requests with its own authorization header.
+	firstAuthorization  = "authorize me"
+	secondAuthorization = "authorize me too"
+)
+
+// Requests through the first listener go to the gateway-proxy service.
+func curlFirstListener(authorization string, statusCode int) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Service:    gloo.GatewayProxy(),
+			Path:       "/",
+			Headers:    authorizationHeaders(authorization),
+			StatusCode: statusCode,
+			Attempts:   30,
+		},
+	}
+}
+
+// Requests through the second listener are port-forwarded to the proxy.
+func curlSecondListener(authorization string, statusCode int) *workflow.Step {
+	return &workflow.Step{
+		Curl: &check.Curl{
+			Path:       "/",
+			Headers:    authorizationHeaders(authorization),
+			StatusCode: statusCode,
+			Attempts:   30,
+			PortForward: &check.PortForward{
+				Namespace:      "gloo-system",
+				DeploymentName: "gateway-proxy",
+				Port:           secondListenerPort,
+			},
+		},
+	}
+}
+
+func authorizationHeaders(authorization string) map[string]string {
+	if authorization == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": authorization}
+}
+
+func GetWorkflow() *workflow.Workflow {
+	return &workflow.Workflow{
+		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
+			gloo.CheckLicense(gloo.DefaultLicense()),
+			gloo.UninstallOtherGlooVersions("gloo-ee-" + glooEnterpriseVersion),
+			gloo.InstallGlooEnterpriseVersion(glooEnterpriseVersion, gloo.DefaultLicense()),
+			gloo.DeleteAllVirtualServices(),
+			gloo.GlooctlCheck(),
+			gloo.BackupGateways(),
+		},
+		Steps: []*workflow.Step{
+			// Deploy example app, and make sure everything is working
+			workflow.Apply("spelunker.yaml").WithId("deploy-spelunker"),
+			workflow.WaitForPods("spelunker").WithId("wait-spelunker"),
+			workflow.Apply("vs.yaml").WithId("vs"),
+			curlFirstListener("", 200),
+
+			// Deploy the auth servers, using the stand-in instead of custom-auth.yaml
+			workflow.Apply("ext-authz-stand-in.yaml").WithId("deploy-ext-authz-stand-in"),
+			workflow.WaitForPods("gloo-system").WithId("wait-ext-authz-stand-in"),
+
+			// Add a second gateway with its own auth server, and point the first gateway at the other one.
+			// The virtual service doesn't use custom auth yet, so both listeners still allow every request.
+			workflow.Apply("gateway-2.yaml").WithId("gateway-2"),
+			gloo.PatchGateway("gateway-patch.yaml"),
+			curlFirstListener("", 200),
+			curlSecondListener("", 200),
+
+			// Enable custom auth on the virtual service, so each listener checks with its own auth server
+			workflow.Apply("vs-2.yaml").WithId("vs-2"),
+			curlFirstListener("", 403),
+			curlFirstListener(firstAuthorization, 200),
+			curlFirstListener(secondAuthorization, 403),
+			curlSecondListener("", 403),
+			curlSecondListener(secondAuthorization, 200),
+			curlSecondListener(firstAuthorization, 403),
+
+			// Cleanup
+			workflow.Delete("gateway-2.yaml").WithId("delete-gateway-2"),
+			gloo.RestoreGateways(),
+			workflow.Delete("vs-2.yaml").WithId("delete-vs"),
+			workflow.Delete("ext-authz-stand-in.yaml").WithId("delete-ext-authz-stand-in"),
+			gloo.DeleteNamespaces("spelunker"),
+			gloo.GlooctlCheck(),
+		},
+	}
+}
+
+func GetTestWorkflow() *tests.TestWorkflow {
+	return &tests.TestWorkflow{
+		Workflow:          GetWorkflow(),
+		Ctx:               workflow.DefaultContext(context.TODO()),
+		TestSerialization: true,
+	}
+}
@@ -0,0 +1,25 @@
+package gatewayextauth_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
+	gatewayextauth "github.com/solo-io/gloo-ref-arch/webinars/gloo-1.4/2-gateway-extauth"
+	"testing"
+)
+
+func TestGatewayExtauth(t *testing.T) {
+	diagnostics.RegisterFailHandlers(".")
+	RunSpecs(t, "Gloo 1.4 Gateway Extauth Suite")
+}
+
+var _ = Describe("Gateway extauth", func() {
+	testWorkflow := gatewayextauth.GetTestWorkflow()
+
+	BeforeSuite(func() {
+		testWorkflow.Setup(".")
+	})
+
+	It("works", func() {
+		testWorkflow.Run(".")
+	})
+})
@@ -2,6 +2,7 @@ package petclinic
 
 import (
 	"context"
+	"github.com/solo-io/gloo-ref-arch/utils/cluster"
 	"github.com/solo-io/gloo-ref-arch/utils/gloo"
 	"github.com/solo-io/valet/pkg/step/check"
 	"github.com/solo-io/valet/pkg/tests"
@@ -46,6 +47,7 @@ func curlContactPageForFix() *workflow.Step {
 func GetWorkflow() *workflow.Workflow {
 	return &workflow.Workflow{
 		SetupSteps: []*workflow.Step{
+			cluster.EnsureLocalCluster(),
 			gloo.InstallGloo(),
 			gloo.DeleteAllVirtualServices(),
 			gloo.GlooctlCheck(),
@@ -54,16 +56,19 @@ func GetWorkflow() *workflow.Workflow {
 			// Part 1: Deploy the monolith
 			workflow.Apply("petclinic.yaml").WithId("deploy-monolith"),
 			workflow.WaitForPods("default").WithId("wait-1"),
+			gloo.WaitForDiscoveredUpstream("default", "petclinic", 8080),
 			workflow.Apply("vs-1.yaml").WithId("vs-1"),
 			initialCurl(),
 			// Part 2: Extend with a new microservice
 			workflow.Apply("petclinic-vets.yaml").WithId("deploy-vets"),
 			workflow.WaitForPods("default").WithId("wait-2"),
+			gloo.WaitForDiscoveredUpstream("default", "petclinic-vets", 8080),
 			workflow.Apply("vs-2.yaml").WithId("vs-2"),
 			curlVetsForUpdate(),
 			// Phase 3: AWS
 			gloo.CreateAwsSecret().WithId("aws-creds"),
 			workflow.Apply("upstream-aws.yaml").WithId("upstream-aws"),
+			gloo.AssertDiscoveredFunctions("aws", gloo.LambdaFunctions, "contact-form:3"),
 			workflow.Apply("vs-3.yaml").WithId("vs-3"),
 			curlContactPageForFix(),
 		},
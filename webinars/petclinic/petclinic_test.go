@@ -4,17 +4,12 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/solo-io/gloo-ref-arch/petclinic"
-	"github.com/solo-io/go-utils/testutils"
+	"github.com/solo-io/gloo-ref-arch/utils/diagnostics"
 	"testing"
 )
 
 func TestPetclinic(t *testing.T) {
-	RegisterFailHandler(Fail)
-	testutils.RegisterPreFailHandler(
-		func() {
-			testutils.PrintTrimmedStack()
-		})
-	testutils.RegisterCommonFailHandlers()
+	diagnostics.RegisterFailHandlers(".")
 	RunSpecs(t, "Petclinic Suite")
 }
 